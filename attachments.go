@@ -0,0 +1,151 @@
+package bt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+const (
+	defaultMaxAttachmentSize      = 1024 * 1024
+	defaultMaxTotalAttachmentSize = 10 * 1024 * 1024
+)
+
+// Attachment is a file sent with a report, such as a log excerpt or a
+// profile.
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+// AttachmentProvider returns attachments to send with a report. Providers
+// run on the goroutine creating the report, after sampling.
+type AttachmentProvider func() []Attachment
+
+type pendingAttachment struct {
+	name string
+	r    io.Reader
+}
+
+// WithAttachment attaches the content of r to the report under the
+// specified name. r is read before Report returns, unless the report is
+// sampled out.
+func WithAttachment(name string, r io.Reader) ReportOption {
+	return func(o *reportOptions) {
+		o.attachments = append(o.attachments, pendingAttachment{name: name, r: r})
+	}
+}
+
+// attachments reads the attachments of a report, adding those returned by
+// the AttachmentProviders. Attachments over MaxAttachmentSize, or that would
+// take the report over MaxTotalAttachmentSize, are left out.
+func (c *Client) attachments(options *reportOptions) []Attachment {
+	maxSize := c.options.MaxAttachmentSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxAttachmentSize
+	}
+	budget := c.options.MaxTotalAttachmentSize
+	if budget <= 0 {
+		budget = defaultMaxTotalAttachmentSize
+	}
+
+	var result []Attachment
+	add := func(attachment Attachment) {
+		size := int64(len(attachment.Data))
+		switch {
+		case size > maxSize:
+			c.debugf("attachment %q is over MaxAttachmentSize, leaving it out", attachment.Name)
+		case size > budget:
+			c.debugf("attachment %q is over MaxTotalAttachmentSize, leaving it out", attachment.Name)
+		default:
+			budget -= size
+			result = append(result, attachment)
+		}
+	}
+
+	for _, pending := range options.attachments {
+		// Read one byte past the limit to tell whether it is exceeded.
+		data, err := io.ReadAll(io.LimitReader(pending.r, maxSize+1))
+		if err != nil {
+			c.debugf("failed to read attachment %q: %v", pending.name, err)
+			continue
+		}
+		add(Attachment{Name: pending.name, Data: data})
+	}
+
+	for _, provider := range c.options.AttachmentProviders {
+		for _, attachment := range runAttachmentProvider(provider) {
+			add(attachment)
+		}
+	}
+
+	return result
+}
+
+// runAttachmentProvider calls provider, recovering from panics so a broken
+// provider doesn't take the application down.
+func runAttachmentProvider(provider AttachmentProvider) (attachments []Attachment) {
+	defer func() {
+		if r := recover(); r != nil {
+			attachments = nil
+		}
+	}()
+
+	return provider()
+}
+
+// multipartReport returns the multipart submission of a report with
+// attachments: the report goes in the upload_file part, and each attachment
+// in an attachment_<name> part.
+func multipartReport(report []byte, attachments []Attachment) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	part, err := createFormFile(mw, "upload_file", "upload_file.json", "application/json")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(report); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range attachments {
+		part, err := createFormFile(mw, "attachment_"+attachment.Name, attachment.Name, "application/octet-stream")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := part.Write(attachment.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func createFormFile(mw *multipart.Writer, field, filename, contentType string) (io.Writer, error) {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		quoteEscaper.Replace(field), quoteEscaper.Replace(filename)))
+	header.Set("Content-Type", contentType)
+	return mw.CreatePart(header)
+}
+
+// uploadContentType returns the Content-Type of a serialized report, which
+// is either JSON or, for reports with attachments, a multipart body. The
+// boundary of a multipart body is found on its first line.
+func uploadContentType(body []byte) string {
+	if !bytes.HasPrefix(body, []byte("--")) {
+		return "application/json"
+	}
+
+	line, _, _ := bytes.Cut(body[2:], []byte("\r\n"))
+	return "multipart/form-data; boundary=" + string(line)
+}
@@ -0,0 +1,52 @@
+package bt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientReportAttachments(t *testing.T) {
+	client, recorder := newTestClient(t, OptionsStruct{
+		AttachmentProviders: []AttachmentProvider{
+			func() []Attachment {
+				return []Attachment{{Name: "config.json", Data: []byte(`{"debug":true}`)}}
+			},
+			func() []Attachment { panic("broken provider") },
+		},
+		MaxAttachmentSize:      10,
+		MaxTotalAttachmentSize: 20,
+		Compression:            CompressionGzip,
+		CompressionThreshold:   1,
+	})
+
+	client.Report("with attachments", nil,
+		WithAttachment("app.log", strings.NewReader("line 1\n")),
+		WithAttachment("too big.log", strings.NewReader(strings.Repeat("x", 11))),
+		WithAttachment("profile.pprof", bytes.NewReader([]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})))
+	client.Report("without attachments", nil)
+	client.FinishSendingReports()
+
+	recorder.m.Lock()
+	defer recorder.m.Unlock()
+	if assert.Len(t, recorder.reports, 2) {
+		assert.Equal(t, "with attachments", recorder.reports[0]["attributes"].(map[string]interface{})["error.message"])
+		// config.json is over the total once the others are in.
+		assert.Equal(t, map[string]string{
+			"attachment_app.log":       "line 1\n",
+			"attachment_profile.pprof": "\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09",
+		}, recorder.attachments[0])
+		assert.Empty(t, recorder.attachments[1])
+	}
+}
+
+func TestUploadContentType(t *testing.T) {
+	assert.Equal(t, "application/json", uploadContentType([]byte(`{"uuid":""}`)))
+
+	body, err := multipartReport([]byte(`{}`), []Attachment{{Name: "a", Data: []byte("b")}})
+	if assert.NoError(t, err) {
+		assert.Regexp(t, `^multipart/form-data; boundary=[0-9a-f]+$`, uploadContentType(body))
+	}
+}
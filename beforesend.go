@@ -0,0 +1,41 @@
+package bt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BeforeSendFunc processes a report before it is sent. It may modify the
+// report and return it, return a different report, or return nil to drop
+// it.
+//
+// The report is the map serialized as the report's JSON and is fully built
+// when the processors run. Its main keys are "attributes" and "annotations"
+// (map[string]interface{}), "threads" (map[string]Thread), "sourceCode"
+// (map[string]SourceCode) and "classifiers" ([]string).
+//
+// Processors run on a send worker, possibly concurrently for different
+// reports. A processor that panics drops the report.
+type BeforeSendFunc func(report map[string]interface{}) map[string]interface{}
+
+// errReportDropped is returned by processAndSend for reports dropped by a
+// BeforeSend processor.
+var errReportDropped = errors.New("report dropped by BeforeSend processor")
+
+// runBeforeSend passes the report through the BeforeSend processors in order.
+// It returns nil if a processor dropped the report.
+func runBeforeSend(processors []BeforeSendFunc, report map[string]interface{}) (result map[string]interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("BeforeSend processor panicked: %v", r)
+		}
+	}()
+
+	for _, processor := range processors {
+		if report = processor(report); report == nil {
+			return nil, nil
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,46 @@
+package bt
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientBeforeSend(t *testing.T) {
+	client, recorder := newTestClient(t, OptionsStruct{
+		BeforeSend: []BeforeSendFunc{
+			func(report map[string]interface{}) map[string]interface{} {
+				attributes := report["attributes"].(map[string]interface{})
+				if attributes["error.message"] == "panic in processor" {
+					panic("processor bug")
+				}
+				attributes["thread.count"] = len(report["threads"].(map[string]Thread))
+				return report
+			},
+			func(report map[string]interface{}) map[string]interface{} {
+				attributes := report["attributes"].(map[string]interface{})
+				if attributes["error.message"] == "known noise" {
+					return nil
+				}
+				return report
+			},
+		},
+	})
+	defer client.FinishSendingReports()
+
+	client.Report(errors.New("known noise"), nil)
+	client.Report(errors.New("panic in processor"), nil)
+	client.Report(errors.New("real problem"), nil)
+
+	result, err := client.Flush(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, DrainResult{Sent: 1, Dropped: 2}, result)
+
+	attributes := recorder.attributes()
+	if assert.Len(t, attributes, 1) {
+		assert.Equal(t, "real problem", attributes[0]["error.message"])
+		assert.Equal(t, float64(1), attributes[0]["thread.count"])
+	}
+}
@@ -0,0 +1,173 @@
+package bt
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultBreadcrumbsCapacity = 100
+
+// BreadcrumbLevel is the severity of a breadcrumb.
+type BreadcrumbLevel int
+
+const (
+	BreadcrumbDebug BreadcrumbLevel = iota
+	BreadcrumbInfo
+	BreadcrumbWarning
+	BreadcrumbError
+	BreadcrumbFatal
+)
+
+func (l BreadcrumbLevel) String() string {
+	switch l {
+	case BreadcrumbDebug:
+		return "debug"
+	case BreadcrumbInfo:
+		return "info"
+	case BreadcrumbWarning:
+		return "warning"
+	case BreadcrumbError:
+		return "error"
+	case BreadcrumbFatal:
+		return "fatal"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the level by name, as expected by Backtrace.
+func (l BreadcrumbLevel) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// Breadcrumb is an application event recorded with AddBreadcrumb. The
+// breadcrumbs recorded before a report are sent with it, in the Breadcrumbs
+// annotation.
+type Breadcrumb struct {
+	ID        uint64                 `json:"id"`
+	Timestamp int64                  `json:"timestamp"` // Milliseconds since the epoch.
+	Level     BreadcrumbLevel        `json:"level"`
+	Category  string                 `json:"type"`
+	Message   string                 `json:"message"`
+	Data      map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// breadcrumbs is a fixed-size ring buffer of the most recent breadcrumbs.
+type breadcrumbs struct {
+	minLevel BreadcrumbLevel
+
+	m      sync.Mutex
+	ring   []Breadcrumb
+	next   int // Index of the slot the next breadcrumb goes into.
+	full   bool
+	lastID uint64
+}
+
+func newBreadcrumbs(capacity int, minLevel BreadcrumbLevel) *breadcrumbs {
+	if capacity == 0 {
+		capacity = defaultBreadcrumbsCapacity
+	}
+	if capacity < 0 {
+		return nil
+	}
+
+	return &breadcrumbs{minLevel: minLevel, ring: make([]Breadcrumb, capacity)}
+}
+
+func (b *breadcrumbs) add(category, message string, level BreadcrumbLevel, data map[string]interface{}) {
+	if b == nil || level < b.minLevel {
+		return
+	}
+
+	// Copy data so later changes by the application don't leak into
+	// reports.
+	var dataCopy map[string]interface{}
+	if len(data) > 0 {
+		dataCopy = make(map[string]interface{}, len(data))
+		for k, v := range data {
+			dataCopy[k] = v
+		}
+	}
+	timestamp := time.Now().UnixMilli()
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.lastID++
+	b.ring[b.next] = Breadcrumb{
+		ID:        b.lastID,
+		Timestamp: timestamp,
+		Level:     level,
+		Category:  category,
+		Message:   message,
+		Data:      dataCopy,
+	}
+	b.next = (b.next + 1) % len(b.ring)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// snapshot returns the recorded breadcrumbs, oldest first, and the ID of the
+// last one.
+func (b *breadcrumbs) snapshot() ([]Breadcrumb, uint64) {
+	if b == nil {
+		return nil, 0
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if !b.full {
+		return append([]Breadcrumb(nil), b.ring[:b.next]...), b.lastID
+	}
+
+	result := make([]Breadcrumb, 0, len(b.ring))
+	result = append(result, b.ring[b.next:]...)
+	result = append(result, b.ring[:b.next]...)
+	return result, b.lastID
+}
+
+func (b *breadcrumbs) clear() {
+	if b == nil {
+		return
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	for i := range b.ring {
+		b.ring[i] = Breadcrumb{}
+	}
+	b.next = 0
+	b.full = false
+}
+
+// AddBreadcrumb records an application event on the default client. The most
+// recent breadcrumbs are attached to every report. data may be nil.
+func AddBreadcrumb(category, message string, level BreadcrumbLevel, data map[string]interface{}) {
+	defaultClient.AddBreadcrumb(category, message, level, data)
+}
+
+// ClearBreadcrumbs discards the breadcrumbs recorded on the default client.
+func ClearBreadcrumbs() {
+	defaultClient.ClearBreadcrumbs()
+}
+
+// AddBreadcrumb records an application event. The most recent breadcrumbs
+// are attached to every report. data may be nil.
+func (c *Client) AddBreadcrumb(category, message string, level BreadcrumbLevel, data map[string]interface{}) {
+	c.getBreadcrumbs().add(category, message, level, data)
+}
+
+// ClearBreadcrumbs discards the breadcrumbs recorded so far.
+func (c *Client) ClearBreadcrumbs() {
+	c.getBreadcrumbs().clear()
+}
+
+func (c *Client) getBreadcrumbs() *breadcrumbs {
+	c.breadcrumbsOnce.Do(func() {
+		c.breadcrumbs = newBreadcrumbs(c.options.BreadcrumbsCapacity, c.options.BreadcrumbsMinLevel)
+	})
+
+	return c.breadcrumbs
+}
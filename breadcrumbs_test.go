@@ -0,0 +1,88 @@
+package bt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreadcrumbsRing(t *testing.T) {
+	b := newBreadcrumbs(3, BreadcrumbInfo)
+
+	b.add("log", "ignored", BreadcrumbDebug, nil)
+	crumbs, lastID := b.snapshot()
+	assert.Empty(t, crumbs)
+	assert.Equal(t, uint64(0), lastID)
+
+	for i := 1; i <= 5; i++ {
+		b.add("log", fmt.Sprint(i), BreadcrumbInfo, nil)
+	}
+	crumbs, lastID = b.snapshot()
+	assert.Equal(t, uint64(5), lastID)
+	if assert.Len(t, crumbs, 3) {
+		assert.Equal(t, "3", crumbs[0].Message)
+		assert.Equal(t, "5", crumbs[2].Message)
+		assert.Equal(t, uint64(5), crumbs[2].ID)
+	}
+
+	b.clear()
+	crumbs, _ = b.snapshot()
+	assert.Empty(t, crumbs)
+
+	assert.Nil(t, newBreadcrumbs(-1, BreadcrumbDebug))
+
+	var wg sync.WaitGroup
+	b = newBreadcrumbs(10, BreadcrumbDebug)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				b.add("log", "concurrent", BreadcrumbInfo, nil)
+			}
+		}()
+	}
+	wg.Wait()
+	crumbs, lastID = b.snapshot()
+	assert.Len(t, crumbs, 10)
+	assert.Equal(t, uint64(800), lastID)
+}
+
+func TestClientSendsBreadcrumbs(t *testing.T) {
+	client, recorder := newTestClient(t, OptionsStruct{})
+	defer client.FinishSendingReports()
+
+	client.AddBreadcrumb("http", "GET /orders", BreadcrumbInfo, map[string]interface{}{"status": 200})
+	client.AddBreadcrumb("user", "signed in as jane@example.com", BreadcrumbDebug, nil)
+	client.Report(errors.New("it broke"), nil)
+	_, _ = client.Flush(context.Background())
+
+	recorder.m.Lock()
+	defer recorder.m.Unlock()
+
+	if !assert.Len(t, recorder.reports, 1) {
+		return
+	}
+	report := recorder.reports[0]
+	assert.Equal(t, float64(2), report["attributes"].(map[string]interface{})["breadcrumbs.lastId"])
+
+	crumbs := report["annotations"].(map[string]interface{})["Breadcrumbs"].([]interface{})
+	for _, crumb := range crumbs {
+		crumb := crumb.(map[string]interface{})
+		assert.NotZero(t, crumb["timestamp"])
+		delete(crumb, "timestamp")
+	}
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"id": float64(1), "level": "info", "type": "http", "message": "GET /orders",
+			"attributes": map[string]interface{}{"status": float64(200)},
+		},
+		map[string]interface{}{
+			"id": float64(2), "level": "debug", "type": "user", "message": "signed in as [REDACTED]",
+		},
+	}, crumbs)
+}
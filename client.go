@@ -0,0 +1,919 @@
+package bt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Client sends error reports to a single Backtrace endpoint. Each Client owns
+// its configuration, attributes, queue and send worker, so one process may
+// report to several projects at once.
+//
+// The package-level functions (Report, ReportPanic, ReportAndRecoverPanic and
+// FinishSendingReports) use a default Client configured through Options.
+type Client struct {
+	options *OptionsStruct
+
+	// Closed when the send worker exits.
+	done chan struct{}
+	// Canceled to abort in-flight uploads when Close runs out of time.
+	ctx    context.Context
+	cancel context.CancelFunc
+	closed atomic.Bool
+
+	// Report counters backing DrainResult.
+	inFlight atomic.Int64
+	sent     atomic.Int64
+	failed   atomic.Int64
+	dropped  atomic.Int64
+
+	// Reports dropped since the last report that was processed; attached
+	// to the next one.
+	unreportedDrops atomic.Int64
+
+	// Components configured from options on first use, as the options of
+	// the default client are set after it is created. The send worker is
+	// started at the same time.
+	setupOnce  sync.Once
+	queue      *reportQueue
+	spool      *spool
+	breaker    *circuitBreaker
+	sampler    *sampler
+	scrubber   *scrubber
+	httpClient *http.Client
+
+	// Limits the number of concurrent uploads across the send workers.
+	uploads chan struct{}
+
+	// Flush bookkeeping; see next.
+	epochLock sync.Mutex
+	epoch     *sync.WaitGroup
+	lastFlush chan struct{}
+
+	breadcrumbsOnce sync.Once
+	breadcrumbs     *breadcrumbs
+
+	// Set when the spool may hold reports that still need to be uploaded.
+	spoolPending atomic.Bool
+	// Held while the spool is replayed, so only one worker does it.
+	replayLock sync.Mutex
+	// Paths of the spooled reports being uploaded by deliver.
+	spooledUploads sync.Map
+}
+
+type reportPayload struct {
+	crash       bool      // Reports the crash of another process; see withStack.
+	callers     []uintptr // Stack of the reporting goroutine, unless reporting a crash.
+	goroutine   string    // Name of the reporting goroutine.
+	stack       []byte    // Stack trace of all goroutines, if captured, or of a crash.
+	origin      []uintptr // Where the reported error was created, if known.
+	attributes  map[string]interface{}
+	annotations map[string]interface{}
+	timestamp   int64
+	classifier  string
+	attachments []Attachment
+
+	// Sampler bucket of the report, and the number of reports it suppressed
+	// which this one carries.
+	fingerprint uint64
+	suppressed  int64
+}
+
+// ReportOption configures a single report.
+type ReportOption func(*reportOptions)
+
+type reportOptions struct {
+	attachments []pendingAttachment
+
+	// Stack of the reporting goroutine, if captured by the caller; see
+	// withCallers.
+	callers []uintptr
+
+	// Set for the report of a crashed process, with its stack trace (if
+	// any) and the classifier of the report; see withStack.
+	crash      bool
+	stack      []byte
+	classifier string
+}
+
+// withCallers makes the report use pcs, as returned by runtime.Callers, as
+// the stack of the reporting goroutine. It is used by integrations whose
+// call site is more relevant than the frames of the integration itself.
+func withCallers(pcs []uintptr) ReportOption {
+	return func(o *reportOptions) {
+		o.callers = pcs
+	}
+}
+
+// withStack makes the report use stack, a stack trace in the format of
+// runtime.Stack whose first goroutine is the faulting one, instead of the
+// stack of the reporting goroutine. It is used to report the crashes of
+// other processes, which are classified by classifier. Nothing about the
+// reporting process is sent, even if stack is nil.
+func withStack(stack []byte, classifier string) ReportOption {
+	return func(o *reportOptions) {
+		o.crash = true
+		o.stack = stack
+		o.classifier = classifier
+	}
+}
+
+// NewClient returns a Client using the specified options and starts its send
+// worker. The default attributes (hostname, process.id, ...) are added to
+// options.Attributes unless they are already set there.
+//
+// Call Close (or FinishSendingReports) on the returned Client once it is no
+// longer needed.
+func NewClient(options OptionsStruct) *Client {
+	attributes := make(map[string]interface{}, len(defaultAttributes)+len(options.Attributes))
+	for k, v := range defaultAttributes {
+		attributes[k] = v
+	}
+	for k, v := range options.Attributes {
+		attributes[k] = v
+	}
+	options.Attributes = attributes
+
+	c := newClient(&options)
+	c.setup()
+	return c
+}
+
+func newClient(options *OptionsStruct) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Client{
+		options: options,
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Report sends an error report. See bt.Report.
+func (c *Client) Report(object interface{}, extraAttributes map[string]interface{}, options ...ReportOption) {
+	if extraAttributes == nil {
+		extraAttributes = map[string]interface{}{}
+	}
+	if extraAttributes["report_type"] == nil {
+		extraAttributes["report_type"] = "error"
+	}
+	switch value := object.(type) {
+	case nil:
+		return
+	case error:
+		c.sendReportString(value.Error(), value, extraAttributes, options)
+	default:
+		c.sendReportString(fmt.Sprint(value), nil, extraAttributes, options)
+	}
+}
+
+// ReportPanic sends an error report in the event of a panic, waits for the
+// report to be sent and re-panics. It must be deferred directly:
+//
+//	defer client.ReportPanic(nil)
+func (c *Client) ReportPanic(extraAttributes map[string]interface{}) {
+	if !c.checkOptions() {
+		return
+	}
+
+	c.reportPanic(recover(), extraAttributes)
+}
+
+// ReportAndRecoverPanic is the same as ReportPanic, but it recovers from the
+// panic and the goroutine lives on.
+func (c *Client) ReportAndRecoverPanic(extraAttributes map[string]interface{}) {
+	if !c.checkOptions() {
+		return
+	}
+
+	c.reportAndRecoverPanic(recover(), extraAttributes)
+}
+
+// FinishSendingReports blocks until all queued reports are sent and stops
+// the send worker. No further reports are sent afterwards.
+//
+// It may block indefinitely; use Close to bound the wait.
+func (c *Client) FinishSendingReports() {
+	_, _ = c.Close(context.Background())
+}
+
+// DrainResult describes the reports handled while Flush or Close waited.
+type DrainResult struct {
+	// Reports that were uploaded.
+	Sent int
+
+	// Reports that could not be uploaded. They are kept in the spool if one
+	// is configured.
+	Failed int
+
+	// Reports that were still queued or being uploaded when the call
+	// returned.
+	Unsent int
+
+	// Reports that were dropped because the queue was full or by a
+	// BeforeSend processor.
+	Dropped int
+}
+
+// Flush blocks until all reports queued before the call have been processed
+// or ctx is done, whichever happens first. The client keeps running
+// afterwards. The returned error is ctx.Err() if ctx ended the wait.
+func (c *Client) Flush(ctx context.Context) (DrainResult, error) {
+	c.setup()
+	start := c.counters()
+
+	flushed := make(flushRequest)
+	c.queue.pushControl(flushed)
+
+	select {
+	case <-flushed:
+	case <-c.done:
+	case <-ctx.Done():
+	}
+
+	return c.drainResult(start), ctx.Err()
+}
+
+// Close stops accepting reports and blocks until the queued reports have been
+// processed or ctx is done, whichever happens first. In the latter case any
+// in-flight upload is aborted and the remaining reports are discarded (but
+// stay in the spool if one is configured). The returned error is ctx.Err() if
+// ctx ended the wait.
+func (c *Client) Close(ctx context.Context) (DrainResult, error) {
+	c.setup()
+	start := c.counters()
+
+	if c.closed.CompareAndSwap(false, true) {
+		c.queue.pushControl(nil)
+		c.queue.close()
+	}
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		c.cancel()
+	}
+
+	return c.drainResult(start), ctx.Err()
+}
+
+func (c *Client) counters() DrainResult {
+	return DrainResult{
+		Sent:    int(c.sent.Load()),
+		Failed:  int(c.failed.Load()),
+		Dropped: int(c.dropped.Load()),
+	}
+}
+
+func (c *Client) drainResult(start DrainResult) DrainResult {
+	end := c.counters()
+
+	return DrainResult{
+		Sent:    end.Sent - start.Sent,
+		Failed:  end.Failed - start.Failed,
+		Unsent:  c.queue.len() + int(c.inFlight.Load()),
+		Dropped: end.Dropped - start.Dropped,
+	}
+}
+
+// reportPanic handles a value returned by recover() in the caller's deferred
+// function. recover() only stops a panic when called directly by the deferred
+// function, so the public wrappers have to call it themselves.
+func (c *Client) reportPanic(err interface{}, extraAttributes map[string]interface{}) {
+	if err == nil {
+		return
+	}
+
+	if extraAttributes == nil {
+		extraAttributes = map[string]interface{}{}
+	}
+	extraAttributes["report_type"] = "panic"
+
+	c.Report(err, extraAttributes)
+	_, _ = c.Flush(context.Background())
+	panic(err)
+}
+
+func (c *Client) reportAndRecoverPanic(err interface{}, extraAttributes map[string]interface{}) {
+	if extraAttributes == nil {
+		extraAttributes = map[string]interface{}{}
+	}
+	extraAttributes["report_type"] = "panic"
+
+	c.Report(err, extraAttributes)
+}
+
+// sendReportString queues a report. err is the reported error, if any.
+func (c *Client) sendReportString(msg string, err error, extraAttributes map[string]interface{}, options []ReportOption) {
+	if !c.checkOptions() || c.closed.Load() {
+		return
+	}
+
+	c.setup()
+
+	reportOptions := &reportOptions{}
+	for _, option := range options {
+		option(reportOptions)
+	}
+
+	classifier := "message"
+	if reportOptions.classifier != "" {
+		classifier = reportOptions.classifier
+	}
+	var chain map[string]interface{}
+	var origin []uintptr
+	fingerprint := callerFingerprint()
+	if reportOptions.callers != nil {
+		fingerprint = callersFingerprint(reportOptions.callers)
+	}
+	if err != nil {
+		var innermost error
+		chain, innermost = errorChain(err)
+		classifier = errorType(innermost)
+
+		// Reports of errors carrying their stack come from where the
+		// error was created rather than where it is reported.
+		if origin = errorCallers(err); origin != nil {
+			fingerprint = callersFingerprint(origin)
+		}
+	}
+
+	// Sample before capturing the stack, which is the expensive part.
+	reportType := fmt.Sprint(extraAttributes["report_type"])
+	send, suppressed := c.sampler.sample(fingerprint, reportType, classifier)
+	if !send {
+		return
+	}
+
+	timestamp := time.Now().Unix()
+
+	attributes := map[string]interface{}{}
+
+	for k, v := range c.options.Attributes {
+		attributes[k] = v
+	}
+
+	attributes["error.message"] = msg
+
+	for k, v := range extraAttributes {
+		attributes[k] = v
+	}
+
+	if suppressed > 0 {
+		attributes["backtrace.reports.suppressed"] = suppressed
+	}
+
+	annotations := map[string]interface{}{}
+	if c.options.SendEnvVars {
+		annotations["Environment Variables"] = getEnvVars()
+	}
+
+	if chain != nil {
+		annotations["Error Chain"] = chain
+	}
+
+	if crumbs, lastID := c.getBreadcrumbs().snapshot(); len(crumbs) > 0 {
+		annotations["Breadcrumbs"] = crumbs
+		attributes["breadcrumbs.lastId"] = lastID
+	}
+
+	payload := &reportPayload{
+		origin:      origin,
+		attributes:  attributes,
+		annotations: annotations,
+		timestamp:   timestamp,
+		classifier:  classifier,
+		fingerprint: fingerprint,
+		suppressed:  suppressed,
+	}
+	if reportOptions.crash {
+		payload.crash = true
+		payload.stack = reportOptions.stack
+	} else {
+		payload.callers = reportOptions.callers
+		if payload.callers == nil {
+			payload.callers = callers()
+		}
+		payload.goroutine = currentGoroutine()
+		if c.options.CaptureAllGoroutines {
+			payload.stack = stack(true)
+		}
+	}
+
+	payload.attachments = c.attachments(reportOptions)
+
+	if _, dropped := c.queue.pushReport(payload); len(dropped) > 0 {
+		for _, report := range dropped {
+			c.sampler.unsample(report.fingerprint, report.suppressed)
+		}
+		c.dropped.Add(int64(len(dropped)))
+		c.unreportedDrops.Add(int64(len(dropped)))
+		c.debugf("queue full, dropped %d report(s)", len(dropped))
+	}
+}
+
+func (c *Client) checkOptions() bool {
+	if len(c.options.Endpoint) == 0 {
+		if !c.options.DebugBacktrace {
+			return false
+		}
+		panic("must set bt.Options.Endpoint")
+	}
+
+	if !strings.HasPrefix(c.options.Endpoint, "https://submit.backtrace.io") {
+		if len(c.options.Token) == 0 {
+			if !c.options.DebugBacktrace {
+				return false
+			}
+			panic("must set bt.Options.Token")
+		}
+	}
+	return true
+}
+
+// spoolReplayRequest asks the send worker to upload the spooled reports.
+type spoolReplayRequest struct{}
+
+// flushRequest is queued behind pending reports; the send worker signals it
+// once every report queued before it has been processed.
+type flushRequest chan struct{}
+
+func (c *Client) sendWorkerMain() {
+	for {
+		queueItem, epoch, ok := c.next()
+		if !ok {
+			// Close was called or ran out of time.
+			return
+		}
+
+		switch value := queueItem.(type) {
+		case *reportPayload:
+			switch err := c.processAndSend(value); err {
+			case nil:
+				c.sent.Add(1)
+			case errReportDropped:
+				c.dropped.Add(1)
+			default:
+				c.failed.Add(1)
+			}
+			c.inFlight.Add(-1)
+			epoch.Done()
+		case spoolReplayRequest:
+			c.replaySpool()
+			epoch.Done()
+		default:
+			panic("invalid queue item")
+		}
+	}
+}
+
+// next returns the next item for a send worker to process. A report is
+// added to the returned epoch, which the worker must mark done after
+// processing it.
+//
+// Flush requests are handled here: a flush request completes once every
+// report taken from the queue before it has been processed, even by other
+// workers, and once the previous flush request completed.
+func (c *Client) next() (interface{}, *sync.WaitGroup, bool) {
+	c.epochLock.Lock()
+	defer c.epochLock.Unlock()
+
+	for {
+		queueItem, ok := c.queue.pop(c.ctx.Done())
+		if !ok {
+			return nil, nil, false
+		}
+
+		switch value := queueItem.(type) {
+		case *reportPayload:
+			c.inFlight.Add(1)
+			c.epoch.Add(1)
+			return value, c.epoch, true
+		case spoolReplayRequest:
+			// Flushes wait for the replay, like for a report.
+			c.epoch.Add(1)
+			return value, c.epoch, true
+		case flushRequest:
+			epoch, previous, flushed := c.epoch, c.lastFlush, make(chan struct{})
+			c.epoch, c.lastFlush = &sync.WaitGroup{}, flushed
+
+			go func() {
+				epoch.Wait()
+				<-previous
+				close(value)
+				close(flushed)
+			}()
+		default:
+			return value, nil, true
+		}
+	}
+}
+
+// processAndSend builds, processes, serializes and uploads a report. It
+// returns errReportDropped if a BeforeSend processor dropped the report.
+func (c *Client) processAndSend(payload *reportPayload) (err error) {
+	sources := newSourceFiles(c.options.TabWidth)
+
+	mainThread := "0"
+	var threads map[string]Thread
+	if payload.crash {
+		// The stack trace of a crashed process, see withStack; the
+		// faulting goroutine comes first.
+		threads = parseThreads(payload.stack, 0, sources)
+	} else {
+		// The reporting goroutine comes first in the stack trace of all
+		// goroutines; its frames were captured with runtime.Callers
+		// instead.
+		threads = map[string]Thread{}
+		if _, others, ok := bytes.Cut(payload.stack, []byte("\n\n")); ok {
+			threads = parseThreads(others, 1, sources)
+		}
+
+		reporter := threadFromCallers(payload.goroutine, payload.callers, true, sources)
+		reporter.Fault = payload.origin == nil
+		threads[mainThread] = reporter
+	}
+
+	if payload.origin != nil {
+		// The reporting goroutine is kept as a secondary thread.
+		mainThread = "origin"
+		origin := threadFromCallers("error origin", payload.origin, false, sources)
+		origin.Fault = true
+		threads[mainThread] = origin
+	}
+
+	if payload.stack != nil {
+		setGoroutineCounts(payload.attributes, payload.stack)
+
+		var omitted int
+		threads, omitted = collapseThreads(threads, []string{"0", "origin"}, sources, c.options.MaxThreadsSize)
+		if omitted > 0 {
+			payload.attributes["goroutines.omitted"] = omitted
+		}
+	}
+
+	// The statistics of this process don't describe a crashed one.
+	if runtime.GOOS == "linux" && !payload.crash {
+		readMemProcInfo(payload.attributes)
+	}
+
+	spooled := false
+	defer func() {
+		// The counts go on the next report that does go out.
+		if err != nil && !spooled {
+			c.sampler.unsample(payload.fingerprint, payload.suppressed)
+		}
+	}()
+
+	if dropped := c.unreportedDrops.Swap(0); dropped > 0 {
+		payload.attributes["backtrace.reports.dropped"] = dropped
+		defer func() {
+			if err != nil && !spooled {
+				c.unreportedDrops.Add(dropped)
+			}
+		}()
+	}
+
+	c.scrubber.scrubAttributes(payload.attributes)
+	c.scrubber.scrubAnnotations(payload.annotations)
+
+	report := map[string]interface{}{}
+	report["uuid"] = createUuid()
+	report["timestamp"] = payload.timestamp
+	report["lang"] = "go"
+	report["langVersion"] = runtime.Version()
+	report["agent"] = "backtrace-go"
+	report["agentVersion"] = Version
+	report["attributes"] = payload.attributes
+	report["annotations"] = payload.annotations
+	report["threads"] = threads
+	if _, ok := threads[mainThread]; ok {
+		// Crash reports without a traceback have no threads.
+		report["mainThread"] = mainThread
+	}
+	report["sourceCode"] = sources.codes
+	report["classifiers"] = []string{payload.classifier}
+
+	report, err = runBeforeSend(c.options.BeforeSend, report)
+	if err != nil {
+		c.debugf("%v", err)
+		return errReportDropped
+	}
+	if report == nil {
+		return errReportDropped
+	}
+
+	if c.options.DebugBacktrace {
+		fmt.Fprintf(os.Stderr, "POST %s\n", c.submissionURL())
+		var err error
+		jsonBytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		fmt.Fprintf(os.Stderr, "%s\n", string(jsonBytes))
+	}
+
+	jsonBytes, err := json.Marshal(report)
+	if err != nil {
+		if c.options.DebugBacktrace {
+			panic(err)
+		}
+		return err
+	}
+
+	if len(payload.attachments) > 0 {
+		if jsonBytes, err = multipartReport(jsonBytes, payload.attachments); err != nil {
+			return err
+		}
+	}
+
+	spooled, err = c.deliver(jsonBytes)
+	return err
+}
+
+// deliver uploads a serialized report. If a spool is configured, the report
+// is written to it first and only removed once the upload succeeded, so it
+// survives both failed uploads and the process exiting early. It returns
+// whether the report was left in the spool to be uploaded later.
+func (c *Client) deliver(report []byte) (bool, error) {
+	c.setup()
+	s := c.spool
+
+	path := ""
+	if s != nil {
+		var err error
+		if path, err = s.write(report); err != nil {
+			c.debugf("failed to spool report: %v", err)
+		} else {
+			// Keep replaySpool from uploading it as well.
+			c.spooledUploads.Store(path, struct{}{})
+			defer c.spooledUploads.Delete(path)
+		}
+	}
+
+	err := c.send(report)
+	if err != nil {
+		c.debugf("failed to send report: %v", err)
+
+		if path != "" && !isPermanentSendError(err) {
+			c.spoolPending.Store(true)
+			return true, err
+		}
+	}
+
+	if path != "" {
+		if err := s.remove(path); err != nil {
+			c.debugf("failed to remove spooled report: %v", err)
+		}
+	}
+
+	// The endpoint is reachable again; upload whatever piled up meanwhile.
+	// The replay is queued rather than run here, so that flushes waiting for
+	// this report, such as the one of ReportPanic, don't wait for it.
+	if err == nil && c.spoolPending.CompareAndSwap(true, false) {
+		c.queue.pushControl(spoolReplayRequest{})
+	}
+
+	return false, err
+}
+
+// replaySpool uploads the spooled reports, oldest first, and stops at the
+// first one that fails to send.
+func (c *Client) replaySpool() {
+	c.setup()
+	s := c.spool
+	if s == nil {
+		return
+	}
+
+	// Another worker is already at it.
+	if !c.replayLock.TryLock() {
+		return
+	}
+	defer c.replayLock.Unlock()
+
+	paths, err := s.pending()
+	if err != nil {
+		c.debugf("failed to list spooled reports: %v", err)
+		return
+	}
+	c.spoolPending.Store(false)
+
+	for _, path := range paths {
+		if _, uploading := c.spooledUploads.Load(path); uploading {
+			continue
+		}
+
+		report, err := s.read(path)
+		if err != nil {
+			c.debugf("failed to read spooled report: %v", err)
+			continue
+		}
+
+		if err := c.send(report); err != nil {
+			c.debugf("failed to send spooled report: %v", err)
+
+			if !isPermanentSendError(err) {
+				c.spoolPending.Store(true)
+				return
+			}
+		}
+
+		if err := s.remove(path); err != nil {
+			c.debugf("failed to remove spooled report: %v", err)
+		}
+	}
+}
+
+func (c *Client) setup() {
+	c.setupOnce.Do(func() {
+		c.sampler = newSampler(c.options)
+		c.scrubber = newScrubber(c.options.Scrub)
+		c.httpClient = newHTTPClient(c.options)
+		c.breaker = newCircuitBreaker(c.options.CircuitBreakerThreshold, c.options.CircuitBreakerCooldown,
+			func(state CircuitState) {
+				c.debugf("circuit breaker %s", state)
+			})
+
+		if c.options.SpoolDir != "" {
+			c.spool = newSpool(c.options.SpoolDir, c.options.SpoolMaxSize, c.options.SpoolMaxAge)
+		}
+
+		workers := c.options.SendWorkers
+		if workers <= 0 {
+			workers = 1
+		}
+		uploads := c.options.MaxConcurrentUploads
+		if uploads <= 0 {
+			uploads = workers
+		}
+		c.uploads = make(chan struct{}, uploads)
+
+		c.queue = newReportQueue(c.options.QueueSize, c.options.QueueOverflow)
+		c.epoch = &sync.WaitGroup{}
+		c.lastFlush = make(chan struct{})
+		close(c.lastFlush)
+
+		if c.spool != nil {
+			// Upload reports left over from a previous run.
+			c.queue.pushControl(spoolReplayRequest{})
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.sendWorkerMain()
+			}()
+		}
+		go func() {
+			wg.Wait()
+			close(c.done)
+		}()
+	})
+}
+
+func (c *Client) submissionURL() string {
+	if len(c.options.Token) != 0 { // if token is set that means its old URL.
+		return fmt.Sprintf("%s/post?format=json&token=%s", c.options.Endpoint, url.QueryEscape(c.options.Token))
+	}
+
+	return c.options.Endpoint
+}
+
+// send uploads a serialized report, retrying failed attempts with
+// exponential backoff or after the delay requested by the endpoint.
+func (c *Client) send(report []byte) error {
+	c.setup()
+
+	maxBackoff := c.options.RetryMaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+	baseBackoff := c.options.RetryBackoff
+	if baseBackoff <= 0 {
+		baseBackoff = defaultRetryBackoff
+	}
+
+	contentType := uploadContentType(report)
+	body, encoding, err := compress(report, c.options.Compression, c.options.CompressionThreshold)
+	if err != nil {
+		return err
+	}
+
+	for retry := 0; ; retry++ {
+		if !c.breaker.allow() {
+			return errCircuitOpen
+		}
+
+		err := c.post(body, contentType, encoding)
+		if err == nil || isPermanentSendError(err) {
+			// The endpoint is up, even if it rejected this report.
+			c.breaker.success()
+			return err
+		}
+
+		retryAfter := time.Duration(0)
+		var se *statusError
+		if errors.As(err, &se) {
+			retryAfter = se.retryAfter
+		}
+		c.breaker.failure(retryAfter)
+
+		if retry >= c.options.MaxRetries {
+			return err
+		}
+
+		delay := backoff(retry, baseBackoff, maxBackoff)
+		if retryAfter > 0 {
+			if retryAfter > maxBackoff {
+				// Don't hold up the queue for that long; the report
+				// is kept in the spool if one is configured.
+				return err
+			}
+			delay = retryAfter
+		}
+
+		c.debugf("failed to send report, retrying in %v: %v", delay, err)
+		select {
+		case <-time.After(delay):
+		case <-c.ctx.Done():
+			return err
+		}
+	}
+}
+
+// CircuitState returns the state of the circuit breaker guarding the
+// endpoint.
+func (c *Client) CircuitState() CircuitState {
+	c.setup()
+	return c.breaker.current()
+}
+
+// post makes a single upload attempt. Responses other than 2xx are returned
+// as a *statusError. encoding is the Content-Encoding of body, if any.
+func (c *Client) post(body []byte, contentType, encoding string) error {
+	select {
+	case c.uploads <- struct{}{}:
+		defer func() { <-c.uploads }()
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+
+	ctx := c.ctx
+	if timeout := uploadTimeout(c.options); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.submissionURL(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if _, err = io.ReadAll(resp.Body); err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		se := &statusError{code: resp.StatusCode, status: resp.Status}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			se.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return se
+	}
+
+	return nil
+}
+
+func (c *Client) debugf(format string, v ...interface{}) {
+	if c.options.DebugBacktrace {
+		log.Printf(format, v...)
+	}
+}
@@ -0,0 +1,236 @@
+package bt
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type reportRecorder struct {
+	m       sync.Mutex
+	reports []map[string]interface{}
+	// Attachments of each report, by field name.
+	attachments []map[string]string
+}
+
+func (r *reportRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body := io.Reader(req.Body)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+
+	attachments := map[string]string{}
+	if mediaType, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, _ := io.ReadAll(part)
+			attachments[part.FormName()] = string(data)
+		}
+		body = strings.NewReader(attachments["upload_file"])
+		delete(attachments, "upload_file")
+	}
+
+	report := map[string]interface{}{}
+	if err := json.NewDecoder(body).Decode(&report); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	r.m.Lock()
+	r.reports = append(r.reports, report)
+	r.attachments = append(r.attachments, attachments)
+	r.m.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *reportRecorder) attributes() []map[string]interface{} {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	result := []map[string]interface{}{}
+	for _, report := range r.reports {
+		result = append(result, report["attributes"].(map[string]interface{}))
+	}
+	return result
+}
+
+func newTestClient(t *testing.T, options OptionsStruct) (*Client, *reportRecorder) {
+	recorder := &reportRecorder{}
+	server := httptest.NewServer(recorder)
+	t.Cleanup(server.Close)
+
+	options.Endpoint = server.URL
+	options.Token = "fake token"
+
+	return NewClient(options), recorder
+}
+
+func TestClientsAreIsolated(t *testing.T) {
+	first, firstRecorder := newTestClient(t, OptionsStruct{
+		Attributes: map[string]interface{}{"project": "first"},
+	})
+	second, secondRecorder := newTestClient(t, OptionsStruct{
+		Attributes: map[string]interface{}{"project": "second"},
+	})
+
+	first.Report(errors.New("first error"), nil)
+	second.Report(errors.New("second error"), map[string]interface{}{"extra": "value"})
+	first.FinishSendingReports()
+	second.FinishSendingReports()
+
+	firstAttributes := firstRecorder.attributes()
+	if assert.Len(t, firstAttributes, 1) {
+		assert.Equal(t, "first", firstAttributes[0]["project"])
+		assert.Equal(t, "first error", firstAttributes[0]["error.message"])
+		assert.Equal(t, "backtrace-go", firstAttributes[0]["backtrace.agent"])
+		assert.Nil(t, firstAttributes[0]["extra"])
+	}
+
+	secondAttributes := secondRecorder.attributes()
+	if assert.Len(t, secondAttributes, 1) {
+		assert.Equal(t, "second", secondAttributes[0]["project"])
+		assert.Equal(t, "second error", secondAttributes[0]["error.message"])
+		assert.Equal(t, "value", secondAttributes[0]["extra"])
+	}
+}
+
+func TestClientReportPanic(t *testing.T) {
+	client, recorder := newTestClient(t, OptionsStruct{})
+	defer client.FinishSendingReports()
+
+	assert.PanicsWithValue(t, "client panic", func() {
+		defer client.ReportPanic(nil)
+		panic("client panic")
+	})
+
+	attributes := recorder.attributes()
+	if assert.Len(t, attributes, 1) {
+		assert.Equal(t, "panic", attributes[0]["report_type"])
+		assert.Equal(t, "client panic", attributes[0]["error.message"])
+	}
+}
+
+func TestClientFlushAndClose(t *testing.T) {
+	client, recorder := newTestClient(t, OptionsStruct{})
+
+	client.Report(errors.New("first"), nil)
+	client.Report(errors.New("second"), nil)
+	result, err := client.Flush(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, DrainResult{Sent: 2}, result)
+	assert.Len(t, recorder.attributes(), 2)
+
+	client.Report(errors.New("third"), nil)
+	result, err = client.Close(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, DrainResult{Sent: 1}, result)
+
+	// Reports are dropped once the client is closed.
+	client.Report(errors.New("fourth"), nil)
+	result, err = client.Flush(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, DrainResult{}, result)
+	assert.Len(t, recorder.attributes(), 3)
+}
+
+func TestClientCloseDeadline(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient(OptionsStruct{Endpoint: server.URL, Token: "fake token"})
+	client.Report(errors.New("stuck"), nil)
+	client.Report(errors.New("queued"), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	result, err := client.Flush(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, DrainResult{Unsent: 2}, result)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result, err = client.Close(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, 0, result.Sent)
+	assert.Equal(t, 2, result.Failed+result.Unsent)
+}
+
+func TestClientSendWorkers(t *testing.T) {
+	var m sync.Mutex
+	current, peak := 0, 0
+	recorder := &reportRecorder{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		current++
+		if current > peak {
+			peak = current
+		}
+		m.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+		recorder.ServeHTTP(w, r)
+
+		m.Lock()
+		current--
+		m.Unlock()
+	}))
+	defer server.Close()
+
+	client := NewClient(OptionsStruct{
+		Endpoint:             server.URL,
+		Token:                "fake token",
+		SendWorkers:          4,
+		MaxConcurrentUploads: 2,
+	})
+	defer client.FinishSendingReports()
+
+	for i := 0; i < 8; i++ {
+		client.Report(errors.New("parallel"), nil)
+	}
+
+	result, err := client.Flush(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, DrainResult{Sent: 8}, result)
+	assert.Len(t, recorder.attributes(), 8)
+
+	m.Lock()
+	defer m.Unlock()
+	assert.Equal(t, 2, peak)
+}
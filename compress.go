@@ -0,0 +1,52 @@
+package bt
+
+import (
+	"bytes"
+	"compress/gzip"
+)
+
+const defaultCompressionThreshold = 4 << 10
+
+// Compression is the compression applied to the body of report uploads.
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	}
+	return "unknown"
+}
+
+// compress returns the body to upload for report and its Content-Encoding,
+// which is empty if the body is not compressed. Reports smaller than
+// threshold bytes, or which don't get smaller, are not compressed.
+func compress(report []byte, compression Compression, threshold int) ([]byte, string, error) {
+	if threshold <= 0 {
+		threshold = defaultCompressionThreshold
+	}
+	if compression != CompressionGzip || len(report) < threshold {
+		return report, "", nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(report); err != nil {
+		return nil, "", err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, "", err
+	}
+
+	if buf.Len() >= len(report) {
+		return report, "", nil
+	}
+	return buf.Bytes(), "gzip", nil
+}
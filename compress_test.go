@@ -0,0 +1,72 @@
+package bt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompress(t *testing.T) {
+	report := bytes.Repeat([]byte(`{"key":"value"}`), 1000)
+
+	body, encoding, err := compress(report, CompressionNone, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, report, body)
+	assert.Empty(t, encoding)
+
+	body, encoding, err = compress(report[:100], CompressionGzip, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, report[:100], body, "reports below the threshold are not compressed")
+	assert.Empty(t, encoding)
+
+	body, encoding, err = compress(report, CompressionGzip, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip", encoding)
+	assert.Less(t, len(body), len(report))
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if assert.NoError(t, err) {
+		decompressed, err := io.ReadAll(zr)
+		assert.NoError(t, err)
+		assert.Equal(t, report, decompressed)
+	}
+
+	// Incompressible reports are sent as is.
+	body, encoding, err = compress([]byte("x"), CompressionGzip, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("x"), body)
+	assert.Empty(t, encoding)
+}
+
+func TestClientCompressesUploads(t *testing.T) {
+	var m sync.Mutex
+	encodings := []string{}
+	recorder := &reportRecorder{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		m.Unlock()
+		recorder.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	client := NewClient(OptionsStruct{
+		Endpoint:             server.URL,
+		Token:                "fake token",
+		Compression:          CompressionGzip,
+		CompressionThreshold: 1,
+	})
+	client.Report("compressed", nil)
+	client.FinishSendingReports()
+
+	assert.Equal(t, []string{"gzip"}, encodings)
+	attributes := recorder.attributes()
+	if assert.Len(t, attributes, 1) {
+		assert.Equal(t, "compressed", attributes[0]["error.message"])
+	}
+}
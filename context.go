@@ -0,0 +1,59 @@
+package bt
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+)
+
+type attributesKey struct{}
+
+// WithAttributes returns a copy of ctx carrying the specified attributes, as
+// alternating keys and values, on top of those already carried by ctx. They
+// are added to the reports sent with ReportContext. Keys that are not
+// strings are formatted with fmt.Sprint, and a final key without a value is
+// ignored.
+func WithAttributes(ctx context.Context, kv ...interface{}) context.Context {
+	parent := contextAttributes(ctx)
+	attributes := make(map[string]interface{}, len(parent)+len(kv)/2)
+	for k, v := range parent {
+		attributes[k] = v
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		attributes[fmt.Sprint(kv[i])] = kv[i+1]
+	}
+
+	return context.WithValue(ctx, attributesKey{}, attributes)
+}
+
+// contextAttributes returns the attributes carried by ctx. The map must not
+// be modified.
+func contextAttributes(ctx context.Context) map[string]interface{} {
+	attributes, _ := ctx.Value(attributesKey{}).(map[string]interface{})
+	return attributes
+}
+
+// ReportContext sends an error report through the default client, like
+// Report. The attributes carried by ctx, see WithAttributes, and its
+// runtime/pprof labels are added to the report; extraAttributes take
+// precedence over them, and the attributes over the labels.
+func ReportContext(ctx context.Context, object interface{}, extraAttributes map[string]interface{}, options ...ReportOption) {
+	defaultClient.ReportContext(ctx, object, extraAttributes, options...)
+}
+
+// ReportContext sends an error report. See bt.ReportContext.
+func (c *Client) ReportContext(ctx context.Context, object interface{}, extraAttributes map[string]interface{}, options ...ReportOption) {
+	attributes := map[string]interface{}{}
+	pprof.ForLabels(ctx, func(key, value string) bool {
+		attributes[key] = value
+		return true
+	})
+	for k, v := range contextAttributes(ctx) {
+		attributes[k] = v
+	}
+	for k, v := range extraAttributes {
+		attributes[k] = v
+	}
+
+	c.Report(object, attributes, options...)
+}
@@ -0,0 +1,35 @@
+package bt
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithAttributes(t *testing.T) {
+	parent := WithAttributes(context.Background(), "tenant", "acme", "user", 1)
+	child := WithAttributes(parent, "user", 2, 3, "number key", "dangling")
+
+	assert.Equal(t, map[string]interface{}{"tenant": "acme", "user": 1}, contextAttributes(parent))
+	assert.Equal(t, map[string]interface{}{"tenant": "acme", "user": 2, "3": "number key"}, contextAttributes(child))
+	assert.Nil(t, contextAttributes(context.Background()))
+}
+
+func TestClientReportContext(t *testing.T) {
+	client, recorder := newTestClient(t, OptionsStruct{})
+
+	ctx := pprof.WithLabels(context.Background(), pprof.Labels("endpoint", "/orders", "tenant", "from label"))
+	ctx = WithAttributes(ctx, "tenant", "acme", "request_id", "r-1")
+	client.ReportContext(ctx, "failed", map[string]interface{}{"request_id": "explicit"})
+	client.FinishSendingReports()
+
+	attributes := recorder.attributes()
+	if assert.Len(t, attributes, 1) {
+		assert.Equal(t, "/orders", attributes[0]["endpoint"])
+		assert.Equal(t, "acme", attributes[0]["tenant"])
+		assert.Equal(t, "explicit", attributes[0]["request_id"])
+		assert.Equal(t, "failed", attributes[0]["error.message"])
+	}
+}
@@ -0,0 +1,118 @@
+package bt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// Set in the environment of the process started by
+	// StartCrashMonitor, to the application.session attribute of the
+	// process starting it.
+	crashMonitorEnv = "BACKTRACE_CRASH_MONITOR"
+
+	// Set to the process ID of the program in the environment of the crash
+	// monitor, when the monitor is not its parent.
+	crashMonitorPIDEnv = "BACKTRACE_CRASH_MONITOR_PID"
+
+	// Time given to the report of a crash to be sent.
+	crashReportTimeout = 30 * time.Second
+)
+
+// StartCrashMonitor sets up the reporting of the crashes the program can't
+// report itself: fatal runtime errors such as concurrent map writes, stack
+// overflows or deadlocks, and panics in goroutines without a deferred
+// ReportPanic. The traceback of the crash is reported through the default
+// client, with the exit code of the program as the process.exitCode
+// attribute. From Go 1.23 the exit code is assumed to be 2, the code of the
+// runtime after printing a traceback, as the monitor can't observe it.
+//
+// StartCrashMonitor starts the program again, with the same arguments, in a
+// separate process watching for crashes. It must be called at the start of
+// main, once Options are set, and everything before it must be safe to run in
+// both processes.
+//
+// From Go 1.23, the crash monitor is the new process, which reads the
+// traceback written with debug.SetCrashOutput. With older versions of Go,
+// the current process becomes the crash monitor: it runs the program in the
+// new process, passing signals on, and exits with the same code once it has
+// reported any crash. StartCrashMonitor then only returns in the new
+// process.
+func StartCrashMonitor() error {
+	return startCrashMonitor()
+}
+
+// crashMonitorSession returns the application.session attribute of the
+// program, which the crash monitor shares with it.
+func crashMonitorSession() string {
+	if session := os.Getenv(crashMonitorEnv); session != "" {
+		return session
+	}
+	if session, ok := defaultClient.options.Attributes["application.session"]; ok {
+		return fmt.Sprint(session)
+	}
+	return createUuid()
+}
+
+// reportCrash reports the crash of a process from its output, if it
+// crashed. exitCode is 0 if unknown.
+func reportCrash(output []byte, pid, exitCode int, session string) {
+	message, traceback, ok := parseCrash(output)
+	if !ok {
+		return
+	}
+
+	attributes := map[string]interface{}{
+		"report_type":         "crash",
+		"process.id":          pid,
+		"application.session": session,
+	}
+	if exitCode != 0 {
+		attributes["process.exitCode"] = exitCode
+	}
+
+	classifier, _, _ := strings.Cut(message, ":")
+	defaultClient.Report(message, attributes, withStack(traceback, classifier))
+
+	ctx, cancel := context.WithTimeout(context.Background(), crashReportTimeout)
+	defer cancel()
+	_, _ = defaultClient.Close(ctx)
+}
+
+// parseCrash finds the crash at the end of the output of a process, such as
+//
+//	panic: something went wrong
+//
+//	goroutine 1 [running]:
+//	main.main()
+//		/src/main.go:5 +0x1d
+//
+// and returns its message and the traceback that follows.
+func parseCrash(output []byte) (message string, traceback []byte, ok bool) {
+	start := -1
+	for _, prefix := range []string{"panic: ", "fatal error: "} {
+		if bytes.HasPrefix(output, []byte(prefix)) {
+			start = max(start, 0)
+		}
+		if i := bytes.LastIndex(output, []byte("\n"+prefix)); i >= 0 {
+			start = max(start, i+1)
+		}
+	}
+	if start < 0 {
+		return "", nil, false
+	}
+	output = output[start:]
+
+	// The traceback starts with the goroutine that crashed; anything in
+	// between, such as the "runtime stack:" of a fatal error, is left out.
+	header, rest, _ := bytes.Cut(output, []byte("\n\n"))
+	if i := bytes.Index(rest, []byte("goroutine ")); i == 0 || (i > 0 && rest[i-1] == '\n') {
+		traceback = bytes.TrimSpace(rest[i:])
+	}
+
+	return strings.TrimSpace(string(header)), traceback, true
+}
@@ -0,0 +1,78 @@
+//go:build go1.23
+// +build go1.23
+
+package bt
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// The Go runtime exits with this code after printing the traceback of a
+// crash.
+const crashExitCode = 2
+
+func startCrashMonitor() error {
+	if session := os.Getenv(crashMonitorEnv); session != "" {
+		runCrashMonitor(session)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(),
+		crashMonitorEnv+"="+crashMonitorSession(),
+		crashMonitorPIDEnv+"="+strconv.Itoa(os.Getpid()))
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = r
+	// SetCrashOutput duplicates the file descriptor, and the monitor has its
+	// own copy of the read end, so both can be closed once it is started.
+	defer r.Close()
+	defer w.Close()
+
+	if err := debug.SetCrashOutput(w, debug.CrashOptions{}); err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		_ = debug.SetCrashOutput(nil, debug.CrashOptions{})
+		return err
+	}
+
+	// Don't leave a zombie behind if the program outlives the monitor.
+	go func() { _ = cmd.Wait() }()
+
+	return nil
+}
+
+// runCrashMonitor reads the crash output of the parent process, which
+// arrives on standard input, reports the crash if there is one, and exits
+// once the parent process is gone.
+func runCrashMonitor(session string) {
+	// The parent may be gone already, so os.Getppid can't be relied on.
+	pid, _ := strconv.Atoi(os.Getenv(crashMonitorPIDEnv))
+
+	output, _ := io.ReadAll(os.Stdin)
+
+	// The exit of the parent can't be observed from here, but the runtime
+	// exits with status 2 once it has printed a traceback, unless
+	// GOTRACEBACK=crash makes it abort instead.
+	exitCode := 0
+	_, traceback, _ := parseCrash(output)
+	if traceback != nil && !strings.HasPrefix(os.Getenv("GOTRACEBACK"), "crash") {
+		exitCode = crashExitCode
+	}
+	reportCrash(output, pid, exitCode, session)
+	os.Exit(0)
+}
@@ -0,0 +1,81 @@
+//go:build !go1.23
+// +build !go1.23
+
+package bt
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+)
+
+// Amount of output of the program kept by the crash monitor, which must hold
+// the traceback of a crash.
+const crashOutputTail = 4 * 1024 * 1024
+
+func startCrashMonitor() error {
+	if session := os.Getenv(crashMonitorEnv); session != "" {
+		// This is the program; share the session with the monitor.
+		if defaultClient.options.Attributes != nil {
+			defaultClient.options.Attributes["application.session"] = session
+		}
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	session := crashMonitorSession()
+	output := &tailBuffer{max: crashOutputTail}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), crashMonitorEnv+"="+session)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, output)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals)
+	go func() {
+		for sig := range signals {
+			_ = cmd.Process.Signal(sig)
+		}
+	}()
+
+	_ = cmd.Wait()
+	signal.Stop(signals)
+
+	exitCode := cmd.ProcessState.ExitCode()
+	if exitCode != 0 {
+		reportCrash(output.bytes(), cmd.Process.Pid, exitCode, session)
+	}
+	if exitCode < 0 {
+		// Killed by a signal.
+		exitCode = 1
+	}
+	os.Exit(exitCode)
+	return nil
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.max:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) bytes() []byte {
+	return b.buf
+}
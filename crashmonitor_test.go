@@ -0,0 +1,109 @@
+package bt
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const crashOutput = `some log line
+panic: not the crash
+
+panic: out of range [recovered]
+	panic: out of range
+
+goroutine 7 [running]:
+main.worker()
+	/src/main.go:12 +0x1d
+created by main.main in goroutine 1
+	/src/main.go:5 +0x25
+`
+
+func TestParseCrash(t *testing.T) {
+	message, traceback, ok := parseCrash([]byte(crashOutput))
+	assert.True(t, ok)
+	assert.Equal(t, "panic: out of range [recovered]\n\tpanic: out of range", message)
+
+	threads, _ := parseThreadsFromStack(traceback, 4)
+	if assert.Len(t, threads, 1) {
+		assert.Equal(t, "goroutine 7 [running]", threads["0"].Name)
+		assert.True(t, threads["0"].Fault)
+		assert.Equal(t, "worker", threads["0"].Stacks[0].FuncName)
+	}
+
+	message, traceback, ok = parseCrash([]byte("fatal error: stack overflow\n\nruntime stack:\nruntime.throw()\n\t/go/panic.go:1\n\ngoroutine 1 [running]:\nmain.f()\n\t/src/main.go:3\n"))
+	assert.True(t, ok)
+	assert.Equal(t, "fatal error: stack overflow", message)
+	assert.Equal(t, "goroutine 1 [running]:\nmain.f()\n\t/src/main.go:3", string(traceback))
+
+	_, _, ok = parseCrash([]byte("exited normally\n"))
+	assert.False(t, ok)
+}
+
+func TestCrashMonitor(t *testing.T) {
+	if endpoint := os.Getenv("BT_TEST_CRASH_ENDPOINT"); endpoint != "" {
+		Options.Endpoint = endpoint
+		Options.Token = "fake token"
+		if err := StartCrashMonitor(); err != nil {
+			panic(err)
+		}
+
+		// Crash in a goroutine without a deferred ReportPanic.
+		time.AfterFunc(0, func() {
+			panic("unhandled panic")
+		})
+		select {}
+	}
+
+	client, recorder := newTestClient(t, OptionsStruct{})
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCrashMonitor$")
+	cmd.Env = append(os.Environ(), "BT_TEST_CRASH_ENDPOINT="+client.options.Endpoint)
+	output, err := cmd.CombinedOutput()
+
+	var exitErr *exec.ExitError
+	if assert.ErrorAs(t, err, &exitErr) {
+		assert.Equal(t, 2, exitErr.ExitCode())
+	}
+	assert.Contains(t, string(output), "panic: unhandled panic")
+
+	recorder.m.Lock()
+	defer recorder.m.Unlock()
+	if assert.Len(t, recorder.reports, 1) {
+		report := recorder.reports[0]
+		attributes := report["attributes"].(map[string]interface{})
+		assert.Equal(t, "panic: unhandled panic", attributes["error.message"])
+		assert.Equal(t, "crash", attributes["report_type"])
+		assert.Equal(t, float64(2), attributes["process.exitCode"])
+		// The crashed process is the one started here from Go 1.23, its
+		// child with older versions.
+		assert.NotZero(t, attributes["process.id"])
+		// The statistics of the monitor process would be misleading.
+		assert.NotContains(t, attributes, "vm.rss.size")
+		assert.Equal(t, []interface{}{"panic"}, report["classifiers"])
+		assert.Contains(t, report["threads"], "0")
+	}
+}
+
+func TestReportCrashWithoutTraceback(t *testing.T) {
+	client, recorder := newTestClient(t, OptionsStruct{CaptureAllGoroutines: true})
+
+	// Such as with GOTRACEBACK=none: nothing about the reporting process
+	// may be sent in its place.
+	client.Report("panic: boom", map[string]interface{}{"report_type": "crash"}, withStack(nil, "panic"))
+	client.FinishSendingReports()
+
+	recorder.m.Lock()
+	defer recorder.m.Unlock()
+	if assert.Len(t, recorder.reports, 1) {
+		report := recorder.reports[0]
+		assert.Empty(t, report["threads"])
+		assert.NotContains(t, report, "mainThread")
+		assert.Empty(t, report["sourceCode"])
+		assert.NotContains(t, report["attributes"], "vm.rss.size")
+		assert.NotContains(t, report["attributes"], "goroutines.count")
+		assert.Equal(t, []interface{}{"panic"}, report["classifiers"])
+	}
+}
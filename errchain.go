@@ -0,0 +1,82 @@
+package bt
+
+import (
+	"reflect"
+)
+
+// Bounds on the part of an error tree recorded in a report, which guard
+// against cyclic and pathologically large trees.
+const (
+	maxErrorChainDepth  = 32
+	maxErrorChainLength = 100
+)
+
+// errorChain walks the tree of errors wrapped by err, following both
+// Unwrap() error and Unwrap() []error (as returned by errors.Join and
+// fmt.Errorf with several %w verbs).
+//
+// It returns the tree as an annotation, one map per error holding its type,
+// its message and its causes, and the innermost cause, reached by always
+// following the first one. The annotation is nil if err wraps nothing.
+func errorChain(err error) (map[string]interface{}, error) {
+	if len(unwrapError(err)) == 0 {
+		return nil, err
+	}
+
+	length := 0
+	innermost := err
+	var walk func(err error, depth int, first bool) map[string]interface{}
+	walk = func(err error, depth int, first bool) map[string]interface{} {
+		length++
+		if first {
+			innermost = err
+		}
+
+		node := map[string]interface{}{
+			"type":    errorType(err),
+			"message": err.Error(),
+		}
+
+		causes := []interface{}{}
+		for i, cause := range unwrapError(err) {
+			if depth >= maxErrorChainDepth || length >= maxErrorChainLength {
+				node["truncated"] = true
+				break
+			}
+			causes = append(causes, walk(cause, depth+1, first && i == 0))
+		}
+		if len(causes) > 0 {
+			node["causes"] = causes
+		}
+
+		return node
+	}
+
+	return walk(err, 0, true), innermost
+}
+
+// unwrapError returns the errors directly wrapped by err, skipping nil ones.
+func unwrapError(err error) []error {
+	var causes []error
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		causes = []error{e.Unwrap()}
+	case interface{ Unwrap() []error }:
+		causes = e.Unwrap()
+	}
+
+	// Don't filter in place: the slice may belong to err.
+	var result []error
+	for _, cause := range causes {
+		if cause != nil {
+			result = append(result, cause)
+		}
+	}
+	return result
+}
+
+// errorType returns the name of the concrete type of err, which is used to
+// classify reports.
+func errorType(err error) string {
+	return reflect.TypeOf(err).String()
+}
@@ -0,0 +1,94 @@
+package bt
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorChain(t *testing.T) {
+	pathErr := &fs.PathError{Op: "open", Path: "config.json", Err: fs.ErrNotExist}
+	joined := errors.Join(fmt.Errorf("loading config: %w", pathErr), errors.New("second"))
+	err := fmt.Errorf("startup: %w", joined)
+
+	chain, innermost := errorChain(err)
+	assert.Equal(t, fs.ErrNotExist, innermost)
+	assert.Equal(t, map[string]interface{}{
+		"type":    "*fmt.wrapError",
+		"message": err.Error(),
+		"causes": []interface{}{map[string]interface{}{
+			"type":    "*errors.joinError",
+			"message": joined.Error(),
+			"causes": []interface{}{
+				map[string]interface{}{
+					"type":    "*fmt.wrapError",
+					"message": "loading config: open config.json: file does not exist",
+					"causes": []interface{}{map[string]interface{}{
+						"type":    "*fs.PathError",
+						"message": "open config.json: file does not exist",
+						"causes": []interface{}{map[string]interface{}{
+							"type":    "*errors.errorString",
+							"message": "file does not exist",
+						}},
+					}},
+				},
+				map[string]interface{}{
+					"type":    "*errors.errorString",
+					"message": "second",
+				},
+			},
+		}},
+	}, chain)
+
+	plain := errors.New("plain")
+	chain, innermost = errorChain(plain)
+	assert.Nil(t, chain)
+	assert.Equal(t, plain, innermost)
+}
+
+type leafError struct{}
+
+func (e leafError) Error() string { return "leaf" }
+
+type cyclicError struct{}
+
+func (e *cyclicError) Error() string { return "cyclic" }
+func (e *cyclicError) Unwrap() error { return e }
+
+func TestErrorChainIsBounded(t *testing.T) {
+	chain, _ := errorChain(&cyclicError{})
+
+	depth := 0
+	for node := chain; node["causes"] != nil; depth++ {
+		node = node["causes"].([]interface{})[0].(map[string]interface{})
+		if node["causes"] == nil {
+			assert.Equal(t, true, node["truncated"])
+		}
+	}
+	assert.Equal(t, maxErrorChainDepth, depth)
+}
+
+func TestClientReportClassifiesByInnermostError(t *testing.T) {
+	client, recorder := newTestClient(t, OptionsStruct{})
+
+	client.Report(fmt.Errorf("reading: %w", &fs.PathError{Op: "read", Path: "x", Err: errors.ErrUnsupported}), nil)
+	client.Report(leafError{}, nil)
+	client.Report("just a message", nil)
+	client.FinishSendingReports()
+
+	recorder.m.Lock()
+	defer recorder.m.Unlock()
+	if assert.Len(t, recorder.reports, 3) {
+		assert.Equal(t, []interface{}{"*errors.errorString"}, recorder.reports[0]["classifiers"])
+		annotations := recorder.reports[0]["annotations"].(map[string]interface{})
+		assert.Equal(t, "*fmt.wrapError", annotations["Error Chain"].(map[string]interface{})["type"])
+
+		assert.Equal(t, []interface{}{"bt.leafError"}, recorder.reports[1]["classifiers"])
+		assert.Nil(t, recorder.reports[1]["annotations"].(map[string]interface{})["Error Chain"])
+
+		assert.Equal(t, []interface{}{"message"}, recorder.reports[2]["classifiers"])
+	}
+}
@@ -0,0 +1,126 @@
+package bt
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+)
+
+// Maximum number of frames recorded by Errorf and WrapError.
+const maxErrorFrames = 64
+
+// stackError is an error that records the stack where it was created. When
+// it is reported, that stack is used as the faulting thread instead of the
+// stack of the goroutine calling Report.
+type stackError struct {
+	err     error
+	callers []uintptr
+}
+
+func newStackError(err error) *stackError {
+	var pcs [maxErrorFrames]uintptr
+	// Skip runtime.Callers, newStackError and Errorf or WrapError.
+	n := runtime.Callers(3, pcs[:])
+
+	return &stackError{err: err, callers: pcs[:n:n]}
+}
+
+func (e *stackError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stackError) Unwrap() error {
+	return e.err
+}
+
+// Callers returns the program counters of the stack where the error was
+// created, as returned by runtime.Callers.
+func (e *stackError) Callers() []uintptr {
+	return e.callers
+}
+
+// Errorf is like fmt.Errorf, but the returned error records the stack of the
+// calling goroutine. When the error, or an error wrapping it, is reported,
+// that stack is sent as the faulting thread, and the stack where Report was
+// called as a secondary thread.
+func Errorf(format string, args ...interface{}) error {
+	return newStackError(fmt.Errorf(format, args...))
+}
+
+// WrapError returns an error wrapping err that records the stack of the
+// calling goroutine, like Errorf. The message of the returned error is the
+// message of err. WrapError returns nil if err is nil.
+func WrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return newStackError(err)
+}
+
+// errorCallers returns the stack recorded by the deepest error carrying one
+// in the tree of errors wrapped by err, or nil if there is none. Besides the
+// errors returned by Errorf and WrapError, it understands the stacks of the
+// errors of third-party libraries, see recordedCallers.
+func errorCallers(err error) []uintptr {
+	var callers []uintptr
+	deepest := -1
+
+	length := 0
+	var walk func(err error, depth int)
+	walk = func(err error, depth int) {
+		length++
+		if depth > deepest {
+			if pcs := recordedCallers(err); len(pcs) > 0 {
+				callers = pcs
+				deepest = depth
+			}
+		}
+
+		for _, cause := range unwrapError(err) {
+			if depth >= maxErrorChainDepth || length >= maxErrorChainLength {
+				return
+			}
+			walk(cause, depth+1)
+		}
+	}
+	walk(err, 0)
+
+	return callers
+}
+
+// recordedCallers returns the program counters recorded by err itself, if
+// it has a Callers() []uintptr method, or a StackTrace method returning a
+// slice of program counters. The latter covers github.com/pkg/errors, whose
+// StackTrace returns a []Frame, Frame being a uintptr, and the libraries
+// compatible with it.
+func recordedCallers(err error) (pcs []uintptr) {
+	// Methods of third-party errors may panic, e.g. on nil receivers.
+	defer func() {
+		if recover() != nil {
+			pcs = nil
+		}
+	}()
+
+	if e, ok := err.(interface{ Callers() []uintptr }); ok {
+		return e.Callers()
+	}
+
+	method := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !method.IsValid() {
+		return nil
+	}
+	methodType := method.Type()
+	if methodType.NumIn() != 0 || methodType.NumOut() != 1 {
+		return nil
+	}
+	if out := methodType.Out(0); out.Kind() != reflect.Slice || out.Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+
+	trace := method.Call(nil)[0]
+	pcs = make([]uintptr, trace.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(trace.Index(i).Uint())
+	}
+	return pcs
+}
@@ -0,0 +1,110 @@
+package bt
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newOriginError() error {
+	return Errorf("origin: %w", errors.ErrUnsupported)
+}
+
+func TestErrorf(t *testing.T) {
+	err := newOriginError()
+	assert.Equal(t, "origin: unsupported operation", err.Error())
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+
+	callers := errorCallers(fmt.Errorf("reported: %w", err))
+	if assert.NotEmpty(t, callers) {
+		thread := threadFromCallers("error origin", callers, false, newSourceFiles(4))
+		assert.Equal(t, "newOriginError", thread.Stacks[0].FuncName)
+		assert.Equal(t, "github.com/backtrace-labs/backtrace-go", thread.Stacks[0].Library)
+		assert.Equal(t, "TestErrorf", thread.Stacks[1].FuncName)
+	}
+
+	assert.Nil(t, WrapError(nil))
+	wrapped := WrapError(err)
+	assert.Equal(t, err.Error(), wrapped.Error())
+	// The deepest stack is the one closest to where the error happened.
+	assert.Equal(t, errorCallers(err), errorCallers(wrapped))
+	assert.Nil(t, errorCallers(errors.New("no stack")))
+}
+
+func TestClientReportUsesErrorOrigin(t *testing.T) {
+	client, recorder := newTestClient(t, OptionsStruct{})
+
+	client.Report(newOriginError(), nil)
+	client.Report(errors.New("no stack"), nil)
+	client.FinishSendingReports()
+
+	recorder.m.Lock()
+	defer recorder.m.Unlock()
+	if !assert.Len(t, recorder.reports, 2) {
+		return
+	}
+
+	report := recorder.reports[0]
+	assert.Equal(t, "origin", report["mainThread"])
+	threads := report["threads"].(map[string]interface{})
+	origin := threads["origin"].(map[string]interface{})
+	assert.Equal(t, true, origin["fault"])
+	frame := origin["stack"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "newOriginError", frame["funcName"])
+	sourceCode := report["sourceCode"].(map[string]interface{})
+	source := sourceCode[frame["sourceCode"].(string)].(map[string]interface{})
+	assert.True(t, strings.HasSuffix(source["path"].(string), "errors_test.go"))
+	for name, thread := range threads {
+		if name != "origin" {
+			assert.Equal(t, false, thread.(map[string]interface{})["fault"])
+		}
+	}
+
+	assert.Equal(t, "0", recorder.reports[1]["mainThread"])
+	assert.Nil(t, recorder.reports[1]["threads"].(map[string]interface{})["origin"])
+}
+
+// pkgError mimics the errors of github.com/pkg/errors, whose StackTrace
+// method returns a slice of Frame, a uintptr.
+type (
+	pkgFrame      uintptr
+	pkgStackTrace []pkgFrame
+	pkgError      struct{ pcs []uintptr }
+)
+
+func (e *pkgError) Error() string { return "pkg error" }
+
+func (e *pkgError) StackTrace() pkgStackTrace {
+	trace := make(pkgStackTrace, len(e.pcs))
+	for i, pc := range e.pcs {
+		trace[i] = pkgFrame(pc)
+	}
+	return trace
+}
+
+// newPkgError records the stack from its caller, like pkg/errors.New.
+func newPkgError() error {
+	var pcs [32]uintptr
+	n := runtime.Callers(2, pcs[:])
+	return &pkgError{pcs: pcs[:n]}
+}
+
+type textStackError struct{}
+
+func (e textStackError) Error() string        { return "text stack" }
+func (e textStackError) StackTrace() []string { return []string{"main.main"} }
+
+func TestThirdPartyErrorStacks(t *testing.T) {
+	err := newPkgError()
+	callers := errorCallers(fmt.Errorf("wrapped: %w", err))
+	assert.Equal(t, err.(*pkgError).pcs, callers)
+	thread := threadFromCallers("error origin", callers, false, newSourceFiles(4))
+	assert.Equal(t, "TestThirdPartyErrorStacks", thread.Stacks[0].FuncName)
+
+	assert.Nil(t, errorCallers(textStackError{}))
+	assert.Nil(t, errorCallers((*pkgError)(nil)), "a panicking StackTrace is ignored")
+}
@@ -0,0 +1,136 @@
+package bt
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Go runs fn in a new goroutine. If fn panics, the panic is reported through
+// the default client and the report is sent before the panic goes on,
+// crashing the program. See Client.Go.
+func Go(fn func()) {
+	defaultClient.goSpawn(spawnAttributes(), fn)
+}
+
+// Go runs fn in a new goroutine. If fn panics, the panic is reported and the
+// report is sent before the panic goes on, crashing the program.
+//
+// The report carries the location of the call to Go as the
+// goroutine.creator attribute, and the ID of the goroutine calling Go as
+// goroutine.parent.
+func (c *Client) Go(fn func()) {
+	c.goSpawn(spawnAttributes(), fn)
+}
+
+func (c *Client) goSpawn(attributes map[string]interface{}, fn func()) {
+	go func() {
+		defer c.recoverSpawned(attributes)
+		fn()
+	}()
+}
+
+// recoverSpawned reports a panic of a goroutine started by Go or Group.Go
+// and passes it on. It must be deferred.
+func (c *Client) recoverSpawned(attributes map[string]interface{}) {
+	if r := recover(); r != nil {
+		c.reportPanic(r, attributes)
+	}
+}
+
+// spawnAttributes returns the attributes identifying the caller of the
+// function calling spawnAttributes, and its goroutine.
+func spawnAttributes() map[string]interface{} {
+	attributes := map[string]interface{}{}
+
+	pcs := make([]uintptr, 1)
+	if runtime.Callers(3, pcs) > 0 {
+		frame, _ := runtime.CallersFrames(pcs).Next()
+		attributes["goroutine.creator"] = fmt.Sprintf("%s (%s:%d)", frame.Function, frame.File, frame.Line)
+	}
+	if id := goroutineID(currentGoroutine()); id != 0 {
+		attributes["goroutine.parent"] = id
+	}
+
+	return attributes
+}
+
+// goroutineID returns the ID in a goroutine header such as
+// "goroutine 1 [running]", or 0 if there is none.
+func goroutineID(header string) int64 {
+	fields := strings.Fields(header)
+	if len(fields) < 2 || fields[0] != "goroutine" {
+		return 0
+	}
+	id, _ := strconv.ParseInt(fields[1], 10, 64)
+	return id
+}
+
+// Group is a collection of goroutines working on subtasks of a common task,
+// like golang.org/x/sync/errgroup.Group, whose panics are reported like those
+// of the goroutines started by Go.
+//
+// The zero Group reports through the default client, and doesn't cancel
+// anything on error.
+type Group struct {
+	client *Client
+	cancel context.CancelCauseFunc
+
+	wg      sync.WaitGroup
+	errOnce sync.Once
+	err     error
+}
+
+// GroupWithContext returns a Group reporting through the default client, and
+// a context derived from ctx which is canceled when a function passed to Go
+// returns an error or when Wait returns, whichever comes first.
+func GroupWithContext(ctx context.Context) (*Group, context.Context) {
+	return defaultClient.GroupWithContext(ctx)
+}
+
+// GroupWithContext returns a Group reporting through c. See
+// bt.GroupWithContext.
+func (c *Client) GroupWithContext(ctx context.Context) (*Group, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &Group{client: c, cancel: cancel}, ctx
+}
+
+// Go runs fn in a new goroutine. The first error returned by the functions
+// passed to Go cancels the context of the group and is returned by Wait. If
+// fn panics, the panic is reported and the report is sent before the panic
+// goes on, crashing the program.
+func (g *Group) Go(fn func() error) {
+	client := g.client
+	if client == nil {
+		client = defaultClient
+	}
+	attributes := spawnAttributes()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer client.recoverSpawned(attributes)
+
+		if err := fn(); err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				if g.cancel != nil {
+					g.cancel(err)
+				}
+			})
+		}
+	}()
+}
+
+// Wait waits for all the functions passed to Go to return, and returns the
+// first error they returned, if any.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	if g.cancel != nil {
+		g.cancel(g.err)
+	}
+	return g.err
+}
@@ -0,0 +1,65 @@
+package bt
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoReportsPanics(t *testing.T) {
+	if endpoint := os.Getenv("BT_TEST_GO_ENDPOINT"); endpoint != "" {
+		client := NewClient(OptionsStruct{Endpoint: endpoint, Token: "fake token"})
+		client.Go(func() {
+			panic("spawned goroutine panicked")
+		})
+		select {}
+	}
+
+	client, recorder := newTestClient(t, OptionsStruct{})
+	cmd := exec.Command(os.Args[0], "-test.run=^TestGoReportsPanics$")
+	cmd.Env = append(os.Environ(), "BT_TEST_GO_ENDPOINT="+client.options.Endpoint)
+	output, err := cmd.CombinedOutput()
+
+	var exitErr *exec.ExitError
+	assert.ErrorAs(t, err, &exitErr, "the panic crashes the program")
+	assert.Contains(t, string(output), "spawned goroutine panicked")
+
+	attributes := recorder.attributes()
+	if assert.Len(t, attributes, 1) {
+		assert.Equal(t, "spawned goroutine panicked", attributes[0]["error.message"])
+		assert.Equal(t, "panic", attributes[0]["report_type"])
+		assert.Contains(t, attributes[0]["goroutine.creator"], "TestGoReportsPanics")
+		assert.Contains(t, attributes[0]["goroutine.creator"], "goroutine_test.go")
+		assert.NotZero(t, attributes[0]["goroutine.parent"])
+	}
+}
+
+func TestGroup(t *testing.T) {
+	client, _ := newTestClient(t, OptionsStruct{})
+	failure := errors.New("first failure")
+
+	group, ctx := client.GroupWithContext(context.Background())
+	group.Go(func() error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	group.Go(func() error {
+		return failure
+	})
+	assert.Equal(t, failure, group.Wait())
+	assert.Equal(t, failure, context.Cause(ctx))
+
+	var zero Group
+	zero.Go(func() error { return nil })
+	assert.NoError(t, zero.Wait())
+}
+
+func TestGoroutineID(t *testing.T) {
+	assert.Equal(t, int64(42), goroutineID("goroutine 42 [running]"))
+	assert.Equal(t, int64(0), goroutineID("thread 42"))
+	assert.NotZero(t, goroutineID(currentGoroutine()))
+}
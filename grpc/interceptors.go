@@ -0,0 +1,211 @@
+// Package btgrpc provides gRPC interceptors reporting panics and failed calls
+// to Backtrace through a bt.Client. Reports are sent with ReportContext and
+// the context of the call.
+package btgrpc
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	bt "github.com/backtrace-labs/backtrace-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata always redacted from reports, whatever the scrubbing options of
+// the client.
+var sensitiveMetadata = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+}
+
+// Options configures the interceptors. Options may be nil.
+type Options struct {
+	// Client sends the reports.
+	//
+	// Defaults to bt.DefaultClient().
+	Client *bt.Client
+
+	// ReportCodes are the status codes of failed calls that are reported,
+	// in addition to panics.
+	//
+	// Defaults to none.
+	ReportCodes []codes.Code
+}
+
+type interceptor struct {
+	client      *bt.Client
+	reportCodes map[codes.Code]bool
+}
+
+func newInterceptor(options *Options) *interceptor {
+	i := &interceptor{client: bt.DefaultClient(), reportCodes: map[codes.Code]bool{}}
+	if options != nil {
+		if options.Client != nil {
+			i.client = options.Client
+		}
+		for _, code := range options.ReportCodes {
+			i.reportCodes[code] = true
+		}
+	}
+
+	return i
+}
+
+// UnaryServerInterceptor returns an interceptor reporting the panics of unary
+// handlers, which fail the call with codes.Internal, and the calls failing
+// with one of Options.ReportCodes.
+func UnaryServerInterceptor(options *Options) grpc.UnaryServerInterceptor {
+	i := newInterceptor(options)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = i.recovered(ctx, r, info.FullMethod, "server")
+			}
+		}()
+
+		resp, err = handler(ctx, req)
+		i.reportStatus(ctx, err, info.FullMethod, "server")
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor.
+func StreamServerInterceptor(options *Options) grpc.StreamServerInterceptor {
+	i := newInterceptor(options)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx := ss.Context()
+		defer func() {
+			if r := recover(); r != nil {
+				err = i.recovered(ctx, r, info.FullMethod, "server")
+			}
+		}()
+
+		err = handler(srv, ss)
+		i.reportStatus(ctx, err, info.FullMethod, "server")
+		return err
+	}
+}
+
+// UnaryClientInterceptor returns an interceptor reporting the calls failing
+// with one of Options.ReportCodes. Panics are reported and passed on.
+func UnaryClientInterceptor(options *Options) grpc.UnaryClientInterceptor {
+	i := newInterceptor(options)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		defer i.reportPanic(ctx, method)
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		i.reportStatus(ctx, err, method, "client")
+		return err
+	}
+}
+
+// StreamClientInterceptor is the streaming counterpart of
+// UnaryClientInterceptor. The errors of the stream's messages are reported as
+// well as the error opening it.
+func StreamClientInterceptor(options *Options) grpc.StreamClientInterceptor {
+	i := newInterceptor(options)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		defer i.reportPanic(ctx, method)
+
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			i.reportStatus(ctx, err, method, "client")
+			return nil, err
+		}
+		return &clientStream{ClientStream: cs, i: i, method: method}, nil
+	}
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	i      *interceptor
+	method string
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != io.EOF {
+		s.i.reportStatus(s.Context(), err, s.method, "client")
+	}
+	return err
+}
+
+// recovered reports a panic recovered from a server handler and returns the
+// error failing the call.
+func (i *interceptor) recovered(ctx context.Context, r interface{}, method, side string) error {
+	attributes := i.attributes(ctx, method, side)
+	attributes["report_type"] = "panic"
+	attributes["grpc.code"] = codes.Internal.String()
+	i.client.ReportContext(ctx, r, attributes)
+
+	return status.Error(codes.Internal, "internal error")
+}
+
+// reportPanic reports a panic and passes it on. It must be deferred.
+func (i *interceptor) reportPanic(ctx context.Context, method string) {
+	if r := recover(); r != nil {
+		attributes := i.attributes(ctx, method, "client")
+		attributes["report_type"] = "panic"
+		i.client.ReportContext(ctx, r, attributes)
+		_, _ = i.client.Flush(context.Background())
+		panic(r)
+	}
+}
+
+// reportStatus reports err if its status code is one of Options.ReportCodes.
+func (i *interceptor) reportStatus(ctx context.Context, err error, method, side string) {
+	if err == nil {
+		return
+	}
+	code := status.Code(err)
+	if !i.reportCodes[code] {
+		return
+	}
+
+	attributes := i.attributes(ctx, method, side)
+	attributes["grpc.code"] = code.String()
+	i.client.ReportContext(ctx, err, attributes)
+}
+
+func (i *interceptor) attributes(ctx context.Context, method, side string) map[string]interface{} {
+	attributes := map[string]interface{}{
+		"grpc.method": method,
+		"grpc.side":   side,
+	}
+	if service, _, ok := strings.Cut(strings.TrimPrefix(method, "/"), "/"); ok {
+		attributes["grpc.service"] = service
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		attributes["grpc.peer"] = p.Addr.String()
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if side == "client" {
+		md, ok = metadata.FromOutgoingContext(ctx)
+	}
+	if ok {
+		for key, values := range md {
+			value := strings.Join(values, ", ")
+			switch {
+			case strings.HasSuffix(key, "-bin"):
+				continue
+			case sensitiveMetadata[key]:
+				value = bt.Redacted
+			}
+			attributes["grpc.metadata."+key] = value
+		}
+	}
+
+	return attributes
+}
@@ -0,0 +1,140 @@
+package btgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	bt "github.com/backtrace-labs/backtrace-go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func newTestClient(t *testing.T) (*bt.Client, func() []map[string]interface{}) {
+	var m sync.Mutex
+	var attributes []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.Lock()
+		attributes = append(attributes, report["attributes"].(map[string]interface{}))
+		m.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	client := bt.NewClient(bt.OptionsStruct{Endpoint: server.URL, Token: "fake token"})
+	return client, func() []map[string]interface{} {
+		client.FinishSendingReports()
+		m.Lock()
+		defer m.Unlock()
+		return attributes
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	client, reports := newTestClient(t)
+	interceptor := UnaryServerInterceptor(&Options{Client: client, ReportCodes: []codes.Code{codes.Unavailable}})
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"authorization", "Bearer abc",
+		"x-tenant", "acme",
+		"trace-bin", "\x00\x01",
+	))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}})
+	info := &grpc.UnaryServerInfo{FullMethod: "/shop.Orders/Create"}
+
+	_, err := interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("out of stock")
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	_, err = interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Unavailable, "database down")
+	})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	_, err = interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "no such order")
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	attributes := reports()
+	if !assert.Len(t, attributes, 2) {
+		return
+	}
+
+	assert.Equal(t, "out of stock", attributes[0]["error.message"])
+	assert.Equal(t, "panic", attributes[0]["report_type"])
+	assert.Equal(t, "/shop.Orders/Create", attributes[0]["grpc.method"])
+	assert.Equal(t, "shop.Orders", attributes[0]["grpc.service"])
+	assert.Equal(t, "server", attributes[0]["grpc.side"])
+	assert.Equal(t, "Internal", attributes[0]["grpc.code"])
+	assert.Equal(t, "10.0.0.1:5000", attributes[0]["grpc.peer"])
+	assert.Equal(t, bt.Redacted, attributes[0]["grpc.metadata.authorization"])
+	assert.Equal(t, "acme", attributes[0]["grpc.metadata.x-tenant"])
+	assert.Nil(t, attributes[0]["grpc.metadata.trace-bin"])
+
+	assert.Equal(t, "rpc error: code = Unavailable desc = database down", attributes[1]["error.message"])
+	assert.Equal(t, "Unavailable", attributes[1]["grpc.code"])
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context { return s.ctx }
+
+func TestStreamServerInterceptor(t *testing.T) {
+	client, reports := newTestClient(t)
+	interceptor := StreamServerInterceptor(&Options{Client: client})
+
+	stream := &testServerStream{ctx: context.Background()}
+	err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: "/shop.Orders/Watch"}, func(srv interface{}, ss grpc.ServerStream) error {
+		panic(errors.New("stream broke"))
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	attributes := reports()
+	if assert.Len(t, attributes, 1) {
+		assert.Equal(t, "stream broke", attributes[0]["error.message"])
+		assert.Equal(t, "/shop.Orders/Watch", attributes[0]["grpc.method"])
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	client, reports := newTestClient(t)
+	interceptor := UnaryClientInterceptor(&Options{Client: client, ReportCodes: []codes.Code{codes.DeadlineExceeded}})
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-tenant", "acme")
+	err := interceptor(ctx, "/shop.Orders/Get", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.DeadlineExceeded, "too slow")
+	})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	assert.PanicsWithValue(t, "bad reply", func() {
+		_ = interceptor(ctx, "/shop.Orders/Get", nil, nil, nil, func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			panic("bad reply")
+		})
+	})
+
+	attributes := reports()
+	if assert.Len(t, attributes, 2) {
+		assert.Equal(t, "DeadlineExceeded", attributes[0]["grpc.code"])
+		assert.Equal(t, "client", attributes[0]["grpc.side"])
+		assert.Equal(t, "acme", attributes[0]["grpc.metadata.x-tenant"])
+		assert.Equal(t, "panic", attributes[1]["report_type"])
+	}
+}
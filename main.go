@@ -1,11 +1,10 @@
 package bt
 
 import (
-	"bytes"
+	"context"
 	cryptorand "crypto/rand"
-	"encoding/json"
+	"crypto/tls"
 	"fmt"
-	"io"
 	"log"
 	mathrand "math/rand"
 	"net/http"
@@ -15,6 +14,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,7 +22,7 @@ import (
 
 const (
 	VersionMajor = 1
-	VersionMinor = 0
+	VersionMinor = 1
 	VersionPatch = 0
 )
 
@@ -50,28 +50,198 @@ type OptionsStruct struct {
 	// SendEnvVars gathers and sends all environment variables with every report if true. Default false.
 	SendEnvVars bool
 
+	// CaptureAllGoroutines sends the stacks of all goroutines with every
+	// report, instead of only the stack of the goroutine sending it.
+	//
+	// Goroutines with the same wait state and stack are sent as one thread.
+	// The threads of other goroutines are left out once the threads take
+	// over MaxThreadsSize bytes; the faulting goroutine and the one sending
+	// the report are always sent. The source code they reference gets what
+	// is left, and files that don't fit are sent without their text.
+	// Defaults to 1 MiB.
 	CaptureAllGoroutines bool
+	MaxThreadsSize       int
 	TabWidth             int
 	ContextLineCount     int
 	Attributes           map[string]interface{}
 	DebugBacktrace       bool
+
+	// SpoolDir, if set, is a directory where reports are stored before they
+	// are uploaded. A report is removed once the endpoint accepted it; reports
+	// that could not be sent are uploaded again once the endpoint is
+	// reachable, including by the next run of the application.
+	//
+	// Each process should use its own directory.
+	SpoolDir string
+
+	// SpoolMaxSize is the maximum total size of the spooled reports in bytes.
+	// The oldest reports are discarded to make room for new ones.
+	//
+	// Defaults to 50 MiB.
+	SpoolMaxSize int64
+
+	// SpoolMaxAge is how long a report is kept in the spool before it is
+	// discarded.
+	//
+	// Defaults to 24 hours.
+	SpoolMaxAge time.Duration
+
+	// MaxRetries is the number of times a failed upload is retried.
+	// Connection errors, 408, 429 and 5xx responses are retried; other 4xx
+	// responses are not.
+	//
+	// Defaults to 0, no retries.
+	MaxRetries int
+
+	// RetryBackoff is the initial delay between retries. The delay doubles
+	// with every retry, up to RetryMaxBackoff, and is randomized. A delay
+	// requested by the endpoint with Retry-After on 429 and 503 responses is
+	// used instead; if it exceeds RetryMaxBackoff the upload is not retried.
+	//
+	// Defaults to 500ms and 30s, respectively.
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
+
+	// CircuitBreakerThreshold is the number of consecutive failed upload
+	// attempts after which uploads are suspended for CircuitBreakerCooldown
+	// (or as long as requested with Retry-After, if longer). A single upload
+	// is then let through to probe the endpoint. Reports are discarded, or
+	// kept in the spool, while uploads are suspended. A negative threshold
+	// disables the circuit breaker.
+	//
+	// Defaults to 5 attempts and 30 seconds, respectively.
+	CircuitBreakerThreshold int
+	CircuitBreakerCooldown  time.Duration
+
+	// QueueSize is the number of reports that can wait to be sent.
+	//
+	// Defaults to 50.
+	QueueSize int
+
+	// QueueOverflow determines what happens to a report when the queue is
+	// full. The number of dropped reports is attached to the next report
+	// sent as the backtrace.reports.dropped attribute.
+	//
+	// Defaults to OverflowBlock.
+	QueueOverflow OverflowPolicy
+
+	// SendWorkers is the number of goroutines processing and uploading
+	// queued reports in parallel. Flush and ReportPanic still wait for every
+	// report queued before them.
+	//
+	// Defaults to 1.
+	SendWorkers int
+
+	// MaxConcurrentUploads limits the number of uploads in flight at once.
+	//
+	// Defaults to SendWorkers.
+	MaxConcurrentUploads int
+
+	// Compression compresses the body of uploads, which is worthwhile for
+	// large reports, e.g. with CaptureAllGoroutines. Reports smaller than
+	// CompressionThreshold bytes are sent uncompressed.
+	//
+	// Defaults to CompressionNone, and a threshold of 4 KiB.
+	Compression          Compression
+	CompressionThreshold int
+
+	// AttachmentProviders are called for every report; the attachments they
+	// return are sent with it, along with those added with WithAttachment.
+	AttachmentProviders []AttachmentProvider
+
+	// Attachments over MaxAttachmentSize bytes, or that would take the
+	// attachments of a report over MaxTotalAttachmentSize bytes, are left
+	// out.
+	//
+	// Defaults to 1 MiB and 10 MiB.
+	MaxAttachmentSize      int64
+	MaxTotalAttachmentSize int64
+
+	// HTTPClient uploads reports. If it is set, Transport, ConnectTimeout,
+	// ResponseTimeout, Proxy and TLSConfig are ignored.
+	HTTPClient *http.Client
+
+	// Transport makes the upload requests. If it is set, Proxy and
+	// TLSConfig are ignored, and ConnectTimeout and ResponseTimeout only
+	// limit each upload attempt as a whole.
+	Transport http.RoundTripper
+
+	// ConnectTimeout limits the time taken to connect to the endpoint,
+	// including the TLS handshake, and ResponseTimeout the time waiting for
+	// the response once a report is sent. Each upload attempt, from
+	// connecting to reading the response, is also limited to their sum, as
+	// an endpoint may stop reading the report.
+	//
+	// Defaults to 10 seconds and 30 seconds.
+	ConnectTimeout  time.Duration
+	ResponseTimeout time.Duration
+
+	// Proxy returns the proxy to use for a request, as
+	// http.Transport.Proxy.
+	//
+	// Defaults to http.ProxyFromEnvironment.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// TLSConfig configures the TLS connections to the endpoint, e.g. with
+	// a custom CA bundle in RootCAs or a client certificate in
+	// Certificates.
+	TLSConfig *tls.Config
+
+	// SampleRate is the fraction of reports that are sent, between 0 and 1.
+	// Sampling happens before the stack is captured.
+	//
+	// Defaults to 1, all reports.
+	SampleRate float64
+
+	// SampleRates overrides SampleRate for reports with a given report_type
+	// attribute or classifier, looked up in that order. A rate of 0 here
+	// suppresses all such reports.
+	SampleRates map[string]float64
+
+	// FingerprintRateLimit limits the number of reports per second sent from
+	// the same call path, allowing bursts of up to FingerprintBurst reports.
+	// The number of reports suppressed by sampling or rate limiting is
+	// attached to the next report sent from the same call path as the
+	// backtrace.reports.suppressed attribute.
+	//
+	// Defaults to 0, no limit, and a burst of 1.
+	FingerprintRateLimit float64
+	FingerprintBurst     int
+
+	// BeforeSend processors run in order on every report before it is sent,
+	// and may modify or drop it. See BeforeSendFunc.
+	BeforeSend []BeforeSendFunc
+
+	// Scrub controls the redaction of passwords, tokens and other sensitive
+	// data from reports. It runs before the BeforeSend processors.
+	// See ScrubOptions.
+	Scrub ScrubOptions
+
+	// BreadcrumbsCapacity is the number of breadcrumbs kept and sent with
+	// each report; older ones are discarded. A negative capacity disables
+	// breadcrumbs. Breadcrumbs below BreadcrumbsMinLevel are ignored.
+	//
+	// Defaults to 100 breadcrumbs of any level.
+	BreadcrumbsCapacity int
+	BreadcrumbsMinLevel BreadcrumbLevel
 }
 
 var Options OptionsStruct
 
 var rng *mathrand.Rand
 
-type reportPayload struct {
-	stack       []byte
-	attributes  map[string]interface{}
-	annotations map[string]interface{}
-	timestamp   int64
-	classifier  string
-}
+// rngLock serializes access to rng, which is shared by the send workers of
+// all clients.
+var rngLock sync.Mutex
+
+// defaultAttributes holds the process-wide attributes gathered at start-up.
+// They are copied into Options.Attributes and into the attributes of every
+// Client created with NewClient.
+var defaultAttributes = map[string]interface{}{}
 
-var queue = make(chan interface{}, 50)
-var doneChan = make(chan struct{})
-var blockChan = make(chan struct{})
+// defaultClient is the Client behind the package-level reporting functions.
+// It reads its configuration from the global Options.
+var defaultClient = newClient(&Options)
 
 func init() {
 	var err error
@@ -96,24 +266,29 @@ func init() {
 	rng = mathrand.New(randSource)
 
 	setDefaultAttributes()
-
-	go sendWorkerMain()
 }
 
 func setDefaultAttributes() {
+	collectDefaultAttributes()
+
 	if Options.Attributes == nil {
 		Options.Attributes = make(map[string]interface{})
 	}
+	for k, v := range defaultAttributes {
+		Options.Attributes[k] = v
+	}
+}
 
+func collectDefaultAttributes() {
 	hostName, _ := os.Hostname()
-	Options.Attributes["backtrace.version"] = Version
-	Options.Attributes["backtrace.agent"] = "backtrace-go"
-	Options.Attributes["hostname"] = hostName
-	Options.Attributes["uname.sysname"] = runtime.GOOS
-	Options.Attributes["cpu.arch"] = runtime.GOARCH
-	Options.Attributes["process.id"] = os.Getpid()
-	Options.Attributes["application.session"] = uuid.New()
-	Options.Attributes["application"] = filepath.Base(os.Args[0])
+	defaultAttributes["backtrace.version"] = Version
+	defaultAttributes["backtrace.agent"] = "backtrace-go"
+	defaultAttributes["hostname"] = hostName
+	defaultAttributes["uname.sysname"] = runtime.GOOS
+	defaultAttributes["cpu.arch"] = runtime.GOARCH
+	defaultAttributes["process.id"] = os.Getpid()
+	defaultAttributes["application.session"] = uuid.New()
+	defaultAttributes["application"] = filepath.Base(os.Args[0])
 
 	guiCommand := []string{}
 	cpuCommand := []string{}
@@ -147,7 +322,7 @@ func setDefaultAttributes() {
 				}
 			}
 
-			Options.Attributes["guid"] = output
+			defaultAttributes["guid"] = output
 		}
 	}
 
@@ -162,13 +337,13 @@ func setDefaultAttributes() {
 				}
 			}
 
-			Options.Attributes["cpu.brand"] = output
+			defaultAttributes["cpu.brand"] = output
 		}
 	}
 
 	if len(osCommand) > 0 {
 		if output := execCommand(osCommand); output != "" {
-			Options.Attributes["uname.version"] = output
+			defaultAttributes["uname.version"] = output
 		}
 	}
 }
@@ -186,88 +361,68 @@ func execCommand(commands []string) string {
 	return string(out)
 }
 
-func Report(object interface{}, extraAttributes map[string]interface{}) {
-	if extraAttributes == nil {
-		extraAttributes = map[string]interface{}{}
-	}
-	if extraAttributes["report_type"] == nil {
-		extraAttributes["report_type"] = "error"
-	}
-	switch value := object.(type) {
-	case nil:
-		return
-	case error:
-		sendReportString(value.Error(), "error", extraAttributes)
-	default:
-		sendReportString(fmt.Sprint(value), "message", extraAttributes)
-	}
+// Report sends an error report through the default client.
+//
+// object can be an error or anything that can be formatted with fmt.Sprint.
+// extraAttributes are added to the report. options apply to this report
+// only, e.g. WithAttachment.
+func Report(object interface{}, extraAttributes map[string]interface{}, options ...ReportOption) {
+	defaultClient.Report(object, extraAttributes, options...)
 }
 
-func sendReportString(msg string, classifier string, extraAttributes map[string]interface{}) {
-	if !checkOptions() {
+// ReportPanic sends an error report through the default client in the event
+// of a panic, waits for the report to be sent and re-panics.
+//
+//	defer bt.ReportPanic(nil)
+func ReportPanic(extraAttributes map[string]interface{}) {
+	if !defaultClient.checkOptions() {
 		return
 	}
 
-	timestamp := time.Now().Unix()
-
-	attributes := map[string]interface{}{}
-
-	for k, v := range Options.Attributes {
-		attributes[k] = v
-	}
-
-	attributes["error.message"] = msg
-
-	for k, v := range extraAttributes {
-		attributes[k] = v
-	}
-
-	annotations := map[string]interface{}{}
-	if Options.SendEnvVars {
-		annotations["Environment Variables"] = getEnvVars()
-	}
-
-	payload := &reportPayload{
-		stack:       stack(Options.CaptureAllGoroutines),
-		attributes:  attributes,
-		annotations: annotations,
-		timestamp:   timestamp,
-		classifier:  classifier,
-	}
-	queue <- payload
+	defaultClient.reportPanic(recover(), extraAttributes)
 }
 
-func ReportPanic(extraAttributes map[string]interface{}) {
-	if !checkOptions() {
+// ReportAndRecoverPanic is the same as ReportPanic, but it recovers from the
+// panic and the goroutine lives on.
+func ReportAndRecoverPanic(extraAttributes map[string]interface{}) {
+	if !defaultClient.checkOptions() {
 		return
 	}
 
-	err := recover()
-	if err == nil {
-		return
-	}
+	defaultClient.reportAndRecoverPanic(recover(), extraAttributes)
+}
 
-	if extraAttributes == nil {
-		extraAttributes = map[string]interface{}{}
-	}
-	extraAttributes["report_type"] = "panic"
+// FinishSendingReports blocks until all reports queued on the default client
+// are sent and stops its send worker. No further reports are sent afterwards.
+//
+// It may block indefinitely; use Close to bound the wait.
+func FinishSendingReports() {
+	defaultClient.FinishSendingReports()
+}
 
-	Report(err, extraAttributes)
-	finishSendingReports(false)
-	panic(err)
+// Flush waits for the reports queued on the default client until ctx is done.
+// See Client.Flush.
+func Flush(ctx context.Context) (DrainResult, error) {
+	return defaultClient.Flush(ctx)
 }
 
-func ReportAndRecoverPanic(extraAttributes map[string]interface{}) {
-	if !checkOptions() {
-		return
-	}
+// Close stops the default client, waiting for its queued reports until ctx is
+// done. See Client.Close.
+func Close(ctx context.Context) (DrainResult, error) {
+	return defaultClient.Close(ctx)
+}
 
-	if extraAttributes == nil {
-		extraAttributes = map[string]interface{}{}
-	}
-	extraAttributes["report_type"] = "panic"
+// DefaultClient returns the client used by the package-level functions.
+func DefaultClient() *Client {
+	return defaultClient
+}
 
-	Report(recover(), extraAttributes)
+func finishSendingReports(kill bool) {
+	if kill {
+		_, _ = Close(context.Background())
+	} else {
+		_, _ = Flush(context.Background())
+	}
 }
 
 func stack(all bool) []byte {
@@ -285,34 +440,17 @@ func getEnvVars() map[string]string {
 	lines := os.Environ()
 	result := map[string]string{}
 	for _, line := range lines {
-		kv := strings.Split(line, "=")
-		result[kv[0]] = kv[1]
+		key, value, _ := strings.Cut(line, "=")
+		result[key] = value
 	}
 	return result
 }
 
-func checkOptions() bool {
-	if len(Options.Endpoint) == 0 {
-		if !Options.DebugBacktrace {
-			return false
-		}
-		panic("must set bt.Options.Endpoint")
-	}
-
-	if !strings.HasPrefix(Options.Endpoint, "https://submit.backtrace.io") {
-		if len(Options.Token) == 0 {
-			if !Options.DebugBacktrace {
-				return false
-			}
-			panic("must set bt.Options.Token")
-		}
-	}
-	return true
-}
-
 func createUuid() string {
 	var uuidBytes [16]byte
+	rngLock.Lock()
 	_, _ = rng.Read(uuidBytes[:]) // This function is documented to never fail.
+	rngLock.Unlock()
 	return fmt.Sprintf("%02x%02x%02x%02x-%02x%02x-%02x%02x-%02x%02x-%02x%02x%02x%02x%02x%02x",
 		uuidBytes[0], uuidBytes[1], uuidBytes[2], uuidBytes[3],
 		uuidBytes[4], uuidBytes[5],
@@ -320,96 +458,3 @@ func createUuid() string {
 		uuidBytes[8], uuidBytes[9],
 		uuidBytes[10], uuidBytes[11], uuidBytes[12], uuidBytes[13], uuidBytes[14], uuidBytes[15])
 }
-
-func sendWorkerMain() {
-	for {
-		select {
-		case queueItem := <-queue:
-			switch value := queueItem.(type) {
-			case nil:
-				doneChan <- struct{}{}
-				return
-			case *reportPayload:
-				processAndSend(value)
-			default:
-				panic("invalid queue item")
-			}
-		case <-blockChan:
-			doneChan <- struct{}{}
-		}
-
-	}
-}
-
-func FinishSendingReports() {
-	finishSendingReports(true)
-}
-func finishSendingReports(kill bool) {
-	if kill {
-		queue <- nil
-	} else {
-		blockChan <- struct{}{}
-	}
-	<-doneChan
-}
-
-func processAndSend(payload *reportPayload) {
-	threads, sourceCode := ParseThreadsFromStack(payload.stack)
-
-	report := map[string]interface{}{}
-	report["uuid"] = createUuid()
-	report["timestamp"] = payload.timestamp
-	report["lang"] = "go"
-	report["langVersion"] = runtime.Version()
-	report["agent"] = "backtrace-go"
-	report["agentVersion"] = Version
-	report["attributes"] = payload.attributes
-	report["annotations"] = payload.annotations
-	report["threads"] = threads
-	report["mainThread"] = "0"
-	report["sourceCode"] = sourceCode
-	report["classifiers"] = []string{payload.classifier}
-
-	if runtime.GOOS == "linux" {
-		readMemProcInfo()
-	}
-
-	fullUrl := Options.Endpoint
-
-	if len(Options.Token) != 0 { // if token is set that means its old URL.
-		fullUrl = fmt.Sprintf("%s/post?format=json&token=%s", Options.Endpoint, url.QueryEscape(Options.Token))
-	}
-
-	if Options.DebugBacktrace {
-		fmt.Fprintf(os.Stderr, "POST %s\n", fullUrl)
-		var err error
-		jsonBytes, err := json.MarshalIndent(report, "", "  ")
-		if err != nil {
-			panic(err)
-		}
-		fmt.Fprintf(os.Stderr, "%s\n", string(jsonBytes))
-	}
-
-	jsonBytes, err := json.Marshal(report)
-	if err != nil {
-		if Options.DebugBacktrace {
-			panic(err)
-		}
-		return
-	}
-	resp, err := http.Post(fullUrl, "application/json", bytes.NewReader(jsonBytes))
-	if err != nil {
-		if Options.DebugBacktrace {
-			panic(err)
-		}
-		return
-	}
-	defer resp.Body.Close()
-
-	if _, err = io.ReadAll(resp.Body); err != nil {
-		if Options.DebugBacktrace {
-			panic(err)
-		}
-		return
-	}
-}
@@ -0,0 +1,227 @@
+package bt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Request headers always redacted from the reports of HTTPMiddleware,
+// whatever the scrubbing options.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// HTTPMiddlewareOptions configures HTTPMiddleware.
+type HTTPMiddlewareOptions struct {
+	// Client sends the reports.
+	//
+	// Defaults to the default client.
+	Client *Client
+
+	// Route returns the route of a request, e.g. "GET /users/{id}", which
+	// is sent as the http.route attribute. It is called after the handler,
+	// and may return "" if the route is unknown.
+	//
+	// Defaults to the http.ServeMux pattern of the request, from Go 1.23.
+	Route func(r *http.Request) string
+
+	// RequestIDHeader is the request header holding the request ID.
+	//
+	// Defaults to X-Request-Id.
+	RequestIDHeader string
+
+	// Report5xx also reports the requests answered with a 5xx status, with
+	// the method, route (if known) and status as the message.
+	Report5xx bool
+}
+
+// HTTPMiddleware returns a handler calling next and reporting its panics.
+// A panicking request is answered with a 500 status, unless the response was
+// already started. options may be nil.
+//
+// Reports carry the method, route, URL, headers, remote address, user agent,
+// request ID and response status of the request as attributes. The
+// credentials in the URL and the Authorization and Cookie headers are
+// redacted, and the attributes are scrubbed according to the options of the
+// client. Reports are sent with ReportContext and the context of the
+// request.
+//
+// Panics with http.ErrAbortHandler are passed on without being reported.
+func HTTPMiddleware(next http.Handler, options *HTTPMiddlewareOptions) http.Handler {
+	m := &httpMiddleware{next: next, client: defaultClient, requestIDHeader: "X-Request-Id"}
+	if options != nil {
+		if options.Client != nil {
+			m.client = options.Client
+		}
+		m.route = options.Route
+		if options.RequestIDHeader != "" {
+			m.requestIDHeader = options.RequestIDHeader
+		}
+		m.report5xx = options.Report5xx
+	}
+
+	return m
+}
+
+type httpMiddleware struct {
+	next            http.Handler
+	client          *Client
+	route           func(r *http.Request) string
+	requestIDHeader string
+	report5xx       bool
+}
+
+func (m *httpMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rw := &statusRecorder{ResponseWriter: w}
+
+	defer func() {
+		if v := recover(); v != nil {
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			if !rw.wroteHeader {
+				http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+
+			attributes := m.attributes(r, rw.status)
+			attributes["report_type"] = "panic"
+			m.client.ReportContext(r.Context(), v, attributes)
+		}
+	}()
+
+	m.next.ServeHTTP(rw, r)
+
+	if m.report5xx && rw.status >= 500 {
+		attributes := m.attributes(r, rw.status)
+		// Grouped by route rather than by path, which often holds IDs.
+		request := r.Method
+		if route, ok := attributes["http.route"].(string); ok {
+			request = route
+			if !strings.HasPrefix(route, r.Method+" ") {
+				request = r.Method + " " + route
+			}
+		}
+		m.client.ReportContext(r.Context(), fmt.Sprintf("%s: %d %s", request, rw.status, http.StatusText(rw.status)),
+			attributes)
+	}
+}
+
+func (m *httpMiddleware) attributes(r *http.Request, status int) map[string]interface{} {
+	route := ""
+	if m.route != nil {
+		route = m.route(r)
+	} else {
+		route = requestPattern(r)
+	}
+
+	attributes := map[string]interface{}{
+		"http.method":      r.Method,
+		"http.url":         m.requestURL(r),
+		"http.remote_addr": r.RemoteAddr,
+		"http.user_agent":  r.UserAgent(),
+	}
+	if route != "" {
+		attributes["http.route"] = route
+	}
+	if status != 0 {
+		attributes["http.status_code"] = status
+	}
+	if id := r.Header.Get(m.requestIDHeader); id != "" {
+		attributes["http.request_id"] = id
+	}
+
+	for name, values := range r.Header {
+		value := strings.Join(values, ", ")
+		if sensitiveHeaders[name] {
+			value = Redacted
+		}
+		attributes["http.header."+strings.ToLower(name)] = value
+	}
+
+	return attributes
+}
+
+// requestURL returns the URL of r without credentials, with the values of
+// the query parameters matching the deny keys of the client's scrubber
+// redacted.
+func (m *httpMiddleware) requestURL(r *http.Request) string {
+	u := *r.URL
+	u.User = nil
+	if u.Host == "" {
+		u.Host = r.Host
+	}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+		if r.TLS != nil {
+			u.Scheme = "https"
+		}
+	}
+
+	if s := newScrubber(m.client.options.Scrub); s != nil && u.RawQuery != "" {
+		query := u.Query()
+		for key, values := range query {
+			if matchAny(s.deny, key) && !matchAny(s.allow, key) {
+				for i := range values {
+					values[i] = Redacted
+				}
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	return u.String()
+}
+
+// statusRecorder records the status of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.status = http.StatusOK
+		w.wroteHeader = true
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if !w.wroteHeader {
+			w.status = http.StatusOK
+			w.wroteHeader = true
+		}
+		f.Flush()
+	}
+}
+
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("http.Hijacker not supported by the ResponseWriter")
+}
+
+// Unwrap gives http.ResponseController access to the wrapped
+// ResponseWriter.
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,11 @@
+//go:build go1.23
+// +build go1.23
+
+package bt
+
+import "net/http"
+
+// requestPattern returns the http.ServeMux pattern matched by r, if any.
+func requestPattern(r *http.Request) string {
+	return r.Pattern
+}
@@ -0,0 +1,12 @@
+//go:build !go1.23
+// +build !go1.23
+
+package bt
+
+import "net/http"
+
+// requestPattern returns the http.ServeMux pattern matched by r, which is
+// only known from Go 1.23.
+func requestPattern(r *http.Request) string {
+	return ""
+}
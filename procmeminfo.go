@@ -50,13 +50,15 @@ var (
 	}
 )
 
-func readMemProcInfo() {
+// readMemProcInfo adds the memory and scheduler statistics of the process to
+// the specified attributes.
+func readMemProcInfo(attributes map[string]interface{}) {
 	for _, path := range paths {
-		readFile(path)
+		readFile(path, attributes)
 	}
 }
 
-func readFile(path string) {
+func readFile(path string, attributes map[string]interface{}) {
 	file, err := os.Open(path)
 	if err != nil {
 		log.Fatal(err)
@@ -84,7 +86,7 @@ func readFile(path string) {
 				if err != nil {
 					continue
 				}
-				Options.Attributes[attr] = value
+				attributes[attr] = value
 			}
 		}
 	}
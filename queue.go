@@ -0,0 +1,196 @@
+package bt
+
+import (
+	"sync"
+)
+
+const defaultQueueSize = 50
+
+// OverflowPolicy determines what happens to a report when the queue of a
+// Client is full.
+type OverflowPolicy int
+
+const (
+	// The reporting goroutine waits until there is room in the queue.
+	OverflowBlock OverflowPolicy = iota
+
+	// The new report is dropped.
+	OverflowDropNewest
+
+	// The oldest queued report is dropped to make room for the new one.
+	OverflowDropOldest
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropNewest:
+		return "drop newest"
+	case OverflowDropOldest:
+		return "drop oldest"
+	}
+	return "unknown"
+}
+
+// reportQueue is the queue between the reporting goroutines and the send
+// workers. Besides reports it carries control items (flush and stop requests,
+// ...) which keep their position relative to the reports, don't count toward
+// the capacity and are never dropped.
+//
+// A nil control item stops the queue: it and any item after it are never
+// returned, and pop returns false from then on.
+type reportQueue struct {
+	capacity int
+	policy   OverflowPolicy
+
+	m       sync.Mutex
+	space   *sync.Cond // Signaled when a report leaves the queue.
+	items   []interface{}
+	reports int // Number of *reportPayload in items.
+	closed  bool
+	stopped bool
+
+	// Receives a value when items are added, to wake a worker up.
+	wake chan struct{}
+	// Closed once the stop item is reached, to wake all workers up.
+	stop chan struct{}
+}
+
+func newReportQueue(capacity int, policy OverflowPolicy) *reportQueue {
+	if capacity <= 0 {
+		capacity = defaultQueueSize
+	}
+
+	q := &reportQueue{
+		capacity: capacity,
+		policy:   policy,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+	q.space = sync.NewCond(&q.m)
+
+	return q
+}
+
+// pushReport queues a report according to the overflow policy. It returns
+// whether the report was queued and the reports dropped to make room for it,
+// or the report itself if it was dropped instead.
+func (q *reportQueue) pushReport(payload *reportPayload) (queued bool, dropped []*reportPayload) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	for !q.closed && q.reports >= q.capacity {
+		switch q.policy {
+		case OverflowDropNewest:
+			return false, []*reportPayload{payload}
+		case OverflowDropOldest:
+			dropped = append(dropped, q.removeOldestReport())
+		default:
+			q.space.Wait()
+		}
+	}
+
+	if q.closed {
+		return false, dropped
+	}
+
+	q.items = append(q.items, payload)
+	q.reports++
+	q.notify()
+
+	return true, dropped
+}
+
+// pushControl queues a control item. It never blocks.
+func (q *reportQueue) pushControl(item interface{}) {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	q.items = append(q.items, item)
+	q.notify()
+}
+
+// pop returns the next item, waiting for one if the queue is empty. It
+// returns false once the queue is stopped or if done is closed first.
+func (q *reportQueue) pop(done <-chan struct{}) (interface{}, bool) {
+	for {
+		q.m.Lock()
+		if q.stopped {
+			q.m.Unlock()
+			return nil, false
+		}
+
+		if len(q.items) > 0 {
+			item := q.items[0]
+			q.items[0] = nil
+			q.items = q.items[1:]
+
+			switch item.(type) {
+			case nil:
+				q.stopped = true
+				close(q.stop)
+				q.m.Unlock()
+				return nil, false
+			case *reportPayload:
+				q.reports--
+				q.space.Signal()
+			}
+
+			// Pass the wake-up on to another worker.
+			if len(q.items) > 0 {
+				q.notify()
+			}
+			q.m.Unlock()
+
+			return item, true
+		}
+		q.m.Unlock()
+
+		select {
+		case <-q.wake:
+		case <-q.stop:
+		case <-done:
+			return nil, false
+		}
+	}
+}
+
+// close makes further reports be rejected and releases the goroutines
+// waiting for room in the queue. Control items are still accepted.
+func (q *reportQueue) close() {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	q.closed = true
+	q.space.Broadcast()
+}
+
+// len returns the number of queued reports.
+func (q *reportQueue) len() int {
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	return q.reports
+}
+
+// removeOldestReport returns the report it removed. It must be called with
+// q.m held, and with reports queued.
+func (q *reportQueue) removeOldestReport() *reportPayload {
+	for i, item := range q.items {
+		if payload, ok := item.(*reportPayload); ok {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			q.reports--
+			return payload
+		}
+	}
+	return nil
+}
+
+// notify must be called with q.m held.
+func (q *reportQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,164 @@
+package bt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportQueueOverflow(t *testing.T) {
+	first, second, third := &reportPayload{}, &reportPayload{}, &reportPayload{}
+	done := make(chan struct{})
+
+	q := newReportQueue(2, OverflowDropNewest)
+	q.pushReport(first)
+	q.pushControl(flushRequest(nil))
+	q.pushReport(second)
+	queued, dropped := q.pushReport(third)
+	assert.False(t, queued)
+	assert.Equal(t, []*reportPayload{third}, dropped)
+	assert.Equal(t, 2, q.len())
+
+	q = newReportQueue(2, OverflowDropOldest)
+	q.pushReport(first)
+	q.pushControl(flushRequest(nil))
+	q.pushReport(second)
+	queued, dropped = q.pushReport(third)
+	assert.True(t, queued)
+	assert.Equal(t, []*reportPayload{first}, dropped)
+
+	// Control items are never dropped and keep their position.
+	items := []interface{}{}
+	for q.len() > 0 {
+		item, _ := q.pop(done)
+		items = append(items, item)
+	}
+	assert.Equal(t, []interface{}{flushRequest(nil), second, third}, items)
+
+	q = newReportQueue(1, OverflowBlock)
+	q.pushReport(first)
+	pushed := make(chan bool)
+	go func() {
+		queued, _ := q.pushReport(second)
+		pushed <- queued
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("expected pushReport to block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	item, _ := q.pop(done)
+	assert.Equal(t, first, item)
+	assert.True(t, <-pushed)
+
+	go func() {
+		queued, _ := q.pushReport(third)
+		pushed <- queued
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.close()
+	assert.False(t, <-pushed, "closing the queue releases blocked reports")
+
+	close(done)
+	item, _ = q.pop(done)
+	assert.Equal(t, second, item)
+	_, ok := q.pop(done)
+	assert.False(t, ok)
+}
+
+func TestClientReportsDroppedCount(t *testing.T) {
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	recorder := &reportRecorder{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case entered <- struct{}{}:
+			<-release
+		default:
+		}
+		recorder.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	client := NewClient(OptionsStruct{
+		Endpoint:      server.URL,
+		Token:         "fake token",
+		QueueSize:     1,
+		QueueOverflow: OverflowDropOldest,
+	})
+
+	client.Report(errors.New("in flight"), nil)
+	<-entered
+	client.Report(errors.New("dropped"), nil)
+	client.Report(errors.New("kept"), nil)
+	close(release)
+
+	result, err := client.Close(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, DrainResult{Sent: 2}, result)
+
+	attributes := recorder.attributes()
+	if assert.Len(t, attributes, 2) {
+		assert.Equal(t, "in flight", attributes[0]["error.message"])
+		assert.Nil(t, attributes[0]["backtrace.reports.dropped"])
+		assert.Equal(t, "kept", attributes[1]["error.message"])
+		assert.Equal(t, float64(1), attributes[1]["backtrace.reports.dropped"])
+	}
+}
+
+func TestClientKeepsDroppedCountOfUnsentReports(t *testing.T) {
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	recorder := &reportRecorder{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case entered <- struct{}{}:
+			<-release
+		default:
+		}
+		recorder.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	client := NewClient(OptionsStruct{
+		Endpoint:      server.URL,
+		Token:         "fake token",
+		QueueSize:     1,
+		QueueOverflow: OverflowDropOldest,
+		BeforeSend: []BeforeSendFunc{
+			func(report map[string]interface{}) map[string]interface{} {
+				if report["attributes"].(map[string]interface{})["error.message"] == "filtered" {
+					return nil
+				}
+				return report
+			},
+		},
+	})
+
+	client.Report(errors.New("in flight"), nil)
+	<-entered
+	client.Report(errors.New("dropped"), nil)
+	client.Report(errors.New("filtered"), nil)
+	close(release)
+	_, err := client.Flush(context.Background())
+	assert.NoError(t, err)
+
+	// The count goes on the next report that is sent instead.
+	client.Report(errors.New("sent"), nil)
+	result, err := client.Close(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, DrainResult{Sent: 1}, result)
+
+	attributes := recorder.attributes()
+	if assert.Len(t, attributes, 2) {
+		assert.Equal(t, "sent", attributes[1]["error.message"])
+		assert.Equal(t, float64(1), attributes[1]["backtrace.reports.dropped"])
+	}
+}
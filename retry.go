@@ -0,0 +1,240 @@
+package bt
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryBackoff            = 500 * time.Millisecond
+	defaultRetryMaxBackoff         = 30 * time.Second
+	defaultCircuitBreakerThreshold = 5
+	defaultCircuitBreakerCooldown  = 30 * time.Second
+)
+
+// errCircuitOpen is returned instead of attempting an upload while the
+// circuit breaker is open.
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+type statusError struct {
+	code       int
+	status     string
+	retryAfter time.Duration
+}
+
+func (s *statusError) Error() string {
+	return "unexpected response: " + s.status
+}
+
+// isPermanentSendError reports whether sending the same report again can't
+// succeed, e.g. because the endpoint rejected it as malformed.
+func isPermanentSendError(err error) bool {
+	var se *statusError
+	if !errors.As(err, &se) {
+		return false
+	}
+
+	return se.code >= 400 && se.code < 500 &&
+		se.code != http.StatusRequestTimeout &&
+		se.code != http.StatusTooManyRequests
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either
+// a number of seconds or an HTTP date. It returns 0 if the value is invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if d := date.Sub(now); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
+// backoff returns the delay before the specified retry (counting from 0)
+// using exponential backoff with full jitter.
+func backoff(retry int, base, max time.Duration) time.Duration {
+	ceiling := base
+	for i := 0; i < retry && ceiling < max; i++ {
+		ceiling *= 2
+	}
+	if ceiling > max {
+		ceiling = max
+	}
+
+	rngLock.Lock()
+	defer rngLock.Unlock()
+
+	return time.Duration(rng.Int63n(int64(ceiling) + 1))
+}
+
+// CircuitState is the state of a Client's circuit breaker.
+type CircuitState int
+
+const (
+	// Uploads are attempted normally.
+	CircuitClosed CircuitState = iota
+
+	// Too many consecutive uploads failed; uploads are not attempted until
+	// the cool-down period expires.
+	CircuitOpen
+
+	// The cool-down period expired and a single trial upload is allowed
+	// through to probe the endpoint.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type circuitBreaker struct {
+	// A threshold <= 0 disables the breaker.
+	threshold int
+	cooldown  time.Duration
+
+	// Called with the new state on every transition.
+	onChange func(CircuitState)
+
+	m         sync.Mutex
+	state     CircuitState
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration, onChange func(CircuitState)) *circuitBreaker {
+	if threshold == 0 {
+		threshold = defaultCircuitBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultCircuitBreakerCooldown
+	}
+
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, onChange: onChange}
+}
+
+// allow reports whether an upload may be attempted now.
+func (b *circuitBreaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.m.Lock()
+	allowed := true
+	changed := false
+	switch b.state {
+	case CircuitOpen:
+		if time.Now().Before(b.openUntil) {
+			allowed = false
+		} else {
+			changed = b.setState(CircuitHalfOpen)
+			b.probing = true
+		}
+	case CircuitHalfOpen:
+		if b.probing {
+			allowed = false
+		} else {
+			b.probing = true
+		}
+	}
+	b.m.Unlock()
+
+	if changed {
+		b.notify(CircuitHalfOpen)
+	}
+	return allowed
+}
+
+// success records that the endpoint handled an upload.
+func (b *circuitBreaker) success() {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.m.Lock()
+	b.failures = 0
+	b.probing = false
+	changed := b.setState(CircuitClosed)
+	b.m.Unlock()
+
+	if changed {
+		b.notify(CircuitClosed)
+	}
+}
+
+// failure records a failed upload. The breaker stays open for at least
+// retryAfter if the endpoint asked for it.
+func (b *circuitBreaker) failure(retryAfter time.Duration) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.m.Lock()
+	b.failures++
+	b.probing = false
+	if b.state == CircuitClosed && b.failures < b.threshold {
+		b.m.Unlock()
+		return
+	}
+
+	cooldown := b.cooldown
+	if retryAfter > cooldown {
+		cooldown = retryAfter
+	}
+	b.openUntil = time.Now().Add(cooldown)
+	changed := b.setState(CircuitOpen)
+	b.m.Unlock()
+
+	if changed {
+		b.notify(CircuitOpen)
+	}
+}
+
+func (b *circuitBreaker) current() CircuitState {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return b.state
+}
+
+// setState must be called with b.m held. It returns whether the state
+// changed.
+func (b *circuitBreaker) setState(state CircuitState) bool {
+	if b.state == state {
+		return false
+	}
+
+	b.state = state
+	return true
+}
+
+// notify must be called without b.m held, so the callback may inspect the
+// breaker.
+func (b *circuitBreaker) notify(state CircuitState) {
+	if b.onChange != nil {
+		b.onChange(state)
+	}
+}
@@ -0,0 +1,119 @@
+package bt
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter("Fri, 01 Mar 2024 12:00:30 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Fri, 01 Mar 2024 11:00:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-1", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+}
+
+func TestBackoff(t *testing.T) {
+	for retry := 0; retry < 10; retry++ {
+		delay := backoff(retry, time.Second, 8*time.Second)
+		assert.GreaterOrEqual(t, delay, time.Duration(0))
+		assert.LessOrEqual(t, delay, time.Second<<retry)
+		assert.LessOrEqual(t, delay, 8*time.Second)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	states := []CircuitState{}
+	b := newCircuitBreaker(2, time.Hour, func(state CircuitState) {
+		states = append(states, state)
+	})
+
+	assert.True(t, b.allow())
+	b.failure(0)
+	assert.Equal(t, CircuitClosed, b.current())
+	b.failure(0)
+	assert.Equal(t, CircuitOpen, b.current())
+	assert.False(t, b.allow())
+
+	// Pretend the cool-down expired.
+	b.openUntil = time.Now()
+	assert.True(t, b.allow())
+	assert.Equal(t, CircuitHalfOpen, b.current())
+	assert.False(t, b.allow(), "only a single probe is let through")
+
+	b.failure(0)
+	assert.Equal(t, CircuitOpen, b.current())
+
+	b.openUntil = time.Now()
+	assert.True(t, b.allow())
+	b.success()
+	assert.Equal(t, CircuitClosed, b.current())
+	assert.True(t, b.allow())
+
+	assert.Equal(t, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}, states)
+
+	disabled := newCircuitBreaker(-1, 0, nil)
+	for i := 0; i < 10; i++ {
+		disabled.failure(0)
+	}
+	assert.True(t, disabled.allow())
+}
+
+func TestClientRetries(t *testing.T) {
+	var attempts atomic.Int32
+	recorder := &reportRecorder{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch attempts.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			recorder.ServeHTTP(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(OptionsStruct{
+		Endpoint:     server.URL,
+		Token:        "fake token",
+		MaxRetries:   3,
+		RetryBackoff: time.Millisecond,
+	})
+	client.Report(errors.New("retried"), nil)
+	client.FinishSendingReports()
+
+	assert.Equal(t, int32(3), attempts.Load())
+	assert.Len(t, recorder.attributes(), 1)
+	assert.Equal(t, CircuitClosed, client.CircuitState())
+}
+
+func TestClientDoesNotRetryRejectedReports(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client := NewClient(OptionsStruct{
+		Endpoint:     server.URL,
+		Token:        "fake token",
+		MaxRetries:   3,
+		RetryBackoff: time.Millisecond,
+	})
+	client.Report(errors.New("rejected"), nil)
+	client.FinishSendingReports()
+
+	assert.Equal(t, int32(1), attempts.Load())
+}
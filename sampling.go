@@ -0,0 +1,181 @@
+package bt
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Upper bound on the number of fingerprints tracked for rate limiting.
+const maxSampledFingerprints = 4096
+
+// sampler decides which reports are sent, according to the sampling rates
+// and the per-fingerprint rate limit in OptionsStruct. Reports with the same
+// fingerprint come from the same call path.
+type sampler struct {
+	rate  float64
+	rates map[string]float64
+	limit float64 // Tokens per second; 0 disables the rate limit.
+	burst float64
+
+	m       sync.Mutex
+	buckets map[uint64]*fingerprintBucket
+}
+
+type fingerprintBucket struct {
+	tokens float64
+	last   time.Time
+
+	// Reports suppressed since the last one sent.
+	suppressed int64
+}
+
+func newSampler(options *OptionsStruct) *sampler {
+	s := &sampler{
+		rate:    options.SampleRate,
+		rates:   options.SampleRates,
+		limit:   options.FingerprintRateLimit,
+		burst:   float64(options.FingerprintBurst),
+		buckets: map[uint64]*fingerprintBucket{},
+	}
+	if s.rate <= 0 || s.rate > 1 {
+		s.rate = 1
+	}
+	if s.burst < 1 {
+		s.burst = 1
+	}
+
+	return s
+}
+
+// sample reports whether a report with the specified fingerprint should be
+// sent. keys are looked up in the per-type sampling rates in order; the
+// first one found overrides the global rate. If the report is to be sent,
+// sample also returns the number of reports with the same fingerprint that
+// were suppressed since the last one sent.
+func (s *sampler) sample(fingerprint uint64, keys ...string) (bool, int64) {
+	rate := s.rate
+	for _, key := range keys {
+		if r, ok := s.rates[key]; ok {
+			rate = r
+			break
+		}
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if rate >= 1 && s.limit <= 0 {
+		// Nothing to track; just hand over what was suppressed before.
+		suppressed := int64(0)
+		if bucket := s.buckets[fingerprint]; bucket != nil {
+			suppressed = bucket.suppressed
+			delete(s.buckets, fingerprint)
+		}
+		return true, suppressed
+	}
+
+	now := time.Now()
+	bucket := s.buckets[fingerprint]
+	if bucket == nil {
+		s.evict(now)
+		bucket = &fingerprintBucket{tokens: s.burst, last: now}
+		s.buckets[fingerprint] = bucket
+	}
+
+	if s.limit > 0 {
+		bucket.tokens += now.Sub(bucket.last).Seconds() * s.limit
+		if bucket.tokens > s.burst {
+			bucket.tokens = s.burst
+		}
+		bucket.last = now
+
+		if bucket.tokens < 1 {
+			bucket.suppressed++
+			return false, 0
+		}
+	}
+
+	if rate < 1 && (rate <= 0 || randFloat64() >= rate) {
+		bucket.suppressed++
+		return false, 0
+	}
+
+	if s.limit > 0 {
+		bucket.tokens--
+	}
+
+	suppressed := bucket.suppressed
+	bucket.suppressed = 0
+	return true, suppressed
+}
+
+// unsample gives suppressed back to the bucket of fingerprint, for a report
+// that carried that count but was not sent after all, so that the next report
+// sent with the same fingerprint carries it instead.
+func (s *sampler) unsample(fingerprint uint64, suppressed int64) {
+	if suppressed == 0 {
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	bucket := s.buckets[fingerprint]
+	if bucket == nil {
+		now := time.Now()
+		s.evict(now)
+		bucket = &fingerprintBucket{tokens: s.burst, last: now}
+		s.buckets[fingerprint] = bucket
+	}
+	bucket.suppressed += suppressed
+}
+
+// evict keeps the number of tracked fingerprints bounded by forgetting the
+// ones whose bucket has refilled and which have no suppressed reports to
+// carry. It must be called with s.m held.
+func (s *sampler) evict(now time.Time) {
+	if len(s.buckets) < maxSampledFingerprints {
+		return
+	}
+
+	for fingerprint, bucket := range s.buckets {
+		refilled := s.limit <= 0 || bucket.tokens+now.Sub(bucket.last).Seconds()*s.limit >= s.burst
+		if refilled && bucket.suppressed == 0 {
+			delete(s.buckets, fingerprint)
+		}
+	}
+
+	if len(s.buckets) >= maxSampledFingerprints {
+		s.buckets = map[uint64]*fingerprintBucket{}
+	}
+}
+
+// callerFingerprint identifies the call path of the calling goroutine. It is
+// much cheaper than capturing the stack.
+func callerFingerprint() uint64 {
+	var pcs [32]uintptr
+	n := runtime.Callers(2, pcs[:])
+	return callersFingerprint(pcs[:n])
+}
+
+// callersFingerprint identifies the call path of a stack recorded with
+// runtime.Callers.
+func callersFingerprint(pcs []uintptr) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, pc := range pcs {
+		binary.LittleEndian.PutUint64(buf[:], uint64(pc))
+		_, _ = h.Write(buf[:])
+	}
+	return h.Sum64()
+}
+
+func randFloat64() float64 {
+	rngLock.Lock()
+	defer rngLock.Unlock()
+
+	return rng.Float64()
+}
@@ -0,0 +1,123 @@
+package bt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplerRates(t *testing.T) {
+	s := newSampler(&OptionsStruct{
+		SampleRates: map[string]float64{"noise": 0, "panic": 1},
+	})
+
+	send, _ := s.sample(1, "noise", "error")
+	assert.False(t, send)
+	send, _ = s.sample(1, "noise", "error")
+	assert.False(t, send)
+
+	send, suppressed := s.sample(1, "panic", "error")
+	assert.True(t, send)
+	assert.Equal(t, int64(2), suppressed)
+
+	send, suppressed = s.sample(1, "error", "error")
+	assert.True(t, send)
+	assert.Equal(t, int64(0), suppressed)
+
+	s = newSampler(&OptionsStruct{SampleRate: 0.5})
+	sent := 0
+	for i := 0; i < 1000; i++ {
+		if send, _ := s.sample(2, "error", "error"); send {
+			sent++
+		}
+	}
+	assert.InDelta(t, 500, sent, 100)
+}
+
+func TestSamplerRateLimit(t *testing.T) {
+	s := newSampler(&OptionsStruct{FingerprintRateLimit: 1, FingerprintBurst: 2})
+
+	for i := 0; i < 2; i++ {
+		send, _ := s.sample(1, "error", "error")
+		assert.True(t, send)
+	}
+	send, _ := s.sample(1, "error", "error")
+	assert.False(t, send)
+
+	// Other call paths have their own bucket.
+	send, _ = s.sample(2, "error", "error")
+	assert.True(t, send)
+
+	// Pretend a second went by.
+	s.buckets[1].last = s.buckets[1].last.Add(-time.Second)
+	send, suppressed := s.sample(1, "error", "error")
+	assert.True(t, send)
+	assert.Equal(t, int64(1), suppressed)
+}
+
+func TestClientRateLimitsReports(t *testing.T) {
+	client, recorder := newTestClient(t, OptionsStruct{FingerprintRateLimit: 0.001})
+	defer client.FinishSendingReports()
+
+	// The reports must come from the same call path.
+	for _, n := range []int{5, 1} {
+		for i := 0; i < n; i++ {
+			client.Report(errors.New("hot loop"), nil)
+		}
+		_, _ = client.Flush(context.Background())
+
+		// Pretend the bucket refilled.
+		for _, bucket := range client.sampler.buckets {
+			bucket.tokens = 1
+		}
+	}
+
+	attributes := recorder.attributes()
+	if assert.Len(t, attributes, 2) {
+		assert.Nil(t, attributes[0]["backtrace.reports.suppressed"])
+		assert.Equal(t, float64(4), attributes[1]["backtrace.reports.suppressed"])
+	}
+}
+
+func TestClientKeepsSuppressedCountOfUnsentReports(t *testing.T) {
+	client, recorder := newTestClient(t, OptionsStruct{
+		FingerprintRateLimit: 0.001,
+		BeforeSend: []BeforeSendFunc{
+			func(report map[string]interface{}) map[string]interface{} {
+				if report["attributes"].(map[string]interface{})["drop"] == true {
+					return nil
+				}
+				return report
+			},
+		},
+	})
+	defer client.FinishSendingReports()
+
+	// The reports must come from the same call path. The report carrying
+	// the suppressed count is dropped, so the next one carries it instead.
+	for _, round := range []struct {
+		n    int
+		drop bool
+	}{{5, false}, {1, true}, {1, false}} {
+		for i := 0; i < round.n; i++ {
+			client.Report(errors.New("hot loop"), map[string]interface{}{"drop": round.drop})
+		}
+		_, _ = client.Flush(context.Background())
+
+		// Pretend the bucket refilled.
+		client.sampler.m.Lock()
+		for _, bucket := range client.sampler.buckets {
+			bucket.tokens = 1
+		}
+		client.sampler.m.Unlock()
+	}
+
+	attributes := recorder.attributes()
+	if assert.Len(t, attributes, 2) {
+		assert.Nil(t, attributes[0]["backtrace.reports.suppressed"])
+		assert.Equal(t, float64(4), attributes[1]["backtrace.reports.suppressed"])
+	}
+}
@@ -0,0 +1,266 @@
+package bt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces scrubbed values in reports.
+const Redacted = "[REDACTED]"
+
+var (
+	// DefaultScrubDenyKeys matches the keys whose values are redacted unless
+	// ScrubOptions.DenyKeys is set. Words match whole segments of keys
+	// separated by ".", "_", "-" or spaces, so "auth_token" is redacted but
+	// "author" and "oauth.provider" are not. Words for secrets also match at
+	// the end of keys, as in "PGPASSWORD" or "accessToken".
+	DefaultScrubDenyKeys = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)(^|[-_. ])` +
+			`(passw(or)?d|pwd|secret|token|api[-_.]?key|auth|authorization|credentials?|private[-_.]?key|cookie|session[-_.]?id|dsn)` +
+			`([-_. ]|$)`),
+		regexp.MustCompile(`(?i)(passw(or)?d|pwd|secret|token|(api|access|secret|private)[-_.]?key)$`),
+	}
+
+	// ScrubEmails matches e-mail addresses.
+	ScrubEmails = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+	// ScrubCardNumbers matches sequences of 13 to 19 digits, optionally
+	// separated by spaces or dashes. Only sequences passing the Luhn check
+	// are redacted.
+	ScrubCardNumbers = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+	// ScrubTokens matches bearer tokens, JWTs, AWS access key IDs, URL
+	// credentials and secret-looking query parameters.
+	ScrubTokens = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*` +
+		`|\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*` +
+		`|\b(?:AKIA|ASIA)[0-9A-Z]{16}\b` +
+		`|://[^/\s:@]+:[^/\s@]+@` +
+		`|\b(?:password|passwd|pwd|secret|token|api[-_]?key|access[-_]?key)=[^&\s]+`)
+
+	// DefaultScrubValues is used unless ScrubOptions.Values is set.
+	DefaultScrubValues = []*regexp.Regexp{ScrubTokens, ScrubEmails, ScrubCardNumbers}
+)
+
+// ScrubOptions controls the redaction of sensitive data from the attributes
+// (including error.message) and annotations of reports, which includes the
+// environment variables sent with SendEnvVars.
+type ScrubOptions struct {
+	// Disabled turns off scrubbing entirely.
+	Disabled bool
+
+	// Values of attributes, annotations and nested maps whose key matches
+	// any of DenyKeys are replaced with Redacted, unless the key also
+	// matches any of AllowKeys.
+	//
+	// DenyKeys defaults to DefaultScrubDenyKeys if nil.
+	DenyKeys  []*regexp.Regexp
+	AllowKeys []*regexp.Regexp
+
+	// Parts of string values matching any of Values are replaced with
+	// Redacted. Values of keys matching AllowKeys are left alone.
+	//
+	// Defaults to DefaultScrubValues if nil; set it to an empty slice to
+	// turn value scrubbing off.
+	Values []*regexp.Regexp
+
+	// HashMachineID replaces the guid and hostname attributes with a keyed
+	// hash of their value, using MachineIDSalt as the key. Reports from the
+	// same machine can still be correlated, but the machine can't be
+	// identified without knowing the salt.
+	HashMachineID bool
+	MachineIDSalt string
+}
+
+// machineIDAttributes are hashed if ScrubOptions.HashMachineID is set.
+var machineIDAttributes = []string{"guid", "hostname"}
+
+type scrubber struct {
+	deny   []*regexp.Regexp
+	allow  []*regexp.Regexp
+	values []*regexp.Regexp
+
+	hashMachineID bool
+	salt          string
+}
+
+func newScrubber(options ScrubOptions) *scrubber {
+	if options.Disabled {
+		return nil
+	}
+
+	s := &scrubber{
+		deny:          options.DenyKeys,
+		allow:         options.AllowKeys,
+		values:        options.Values,
+		hashMachineID: options.HashMachineID,
+		salt:          options.MachineIDSalt,
+	}
+	if s.deny == nil {
+		s.deny = DefaultScrubDenyKeys
+	}
+	if s.values == nil {
+		s.values = DefaultScrubValues
+	}
+
+	return s
+}
+
+// scrubAttributes scrubs report attributes in place.
+func (s *scrubber) scrubAttributes(attributes map[string]interface{}) {
+	if s == nil {
+		return
+	}
+
+	if s.hashMachineID {
+		for _, key := range machineIDAttributes {
+			if value, ok := attributes[key]; ok {
+				attributes[key] = s.hash(fmt.Sprint(value))
+			}
+		}
+	}
+
+	s.scrubMap(attributes)
+}
+
+// scrubAnnotations scrubs report annotations in place.
+func (s *scrubber) scrubAnnotations(annotations map[string]interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.scrubMap(annotations)
+}
+
+// scrubMap scrubs m in place.
+func (s *scrubber) scrubMap(m map[string]interface{}) {
+	for key, value := range m {
+		m[key] = s.scrubValue(key, value)
+	}
+}
+
+// scrubValue returns the scrubbed value. Nested maps and slices are copied
+// rather than modified, as they may be shared with the application.
+func (s *scrubber) scrubValue(key string, value interface{}) interface{} {
+	if matchAny(s.allow, key) {
+		return value
+	}
+	if matchAny(s.deny, key) {
+		return Redacted
+	}
+
+	switch v := value.(type) {
+	case string:
+		return s.scrubString(v)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			result[k] = s.scrubValue(k, item)
+		}
+		return result
+	case map[string]string:
+		result := make(map[string]string, len(v))
+		for k, item := range v {
+			result[k] = s.scrubValue(k, item).(string)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = s.scrubValue(key, item)
+		}
+		return result
+	case []string:
+		result := make([]string, len(v))
+		for i, item := range v {
+			result[i] = s.scrubString(item)
+		}
+		return result
+	case []map[string]interface{}:
+		result := make([]map[string]interface{}, len(v))
+		for i, item := range v {
+			result[i] = s.scrubValue(key, item).(map[string]interface{})
+		}
+		return result
+	case []Breadcrumb:
+		result := make([]Breadcrumb, len(v))
+		for i, crumb := range v {
+			crumb.Message = s.scrubString(crumb.Message)
+			if crumb.Data != nil {
+				crumb.Data = s.scrubValue(key, crumb.Data).(map[string]interface{})
+			}
+			result[i] = crumb
+		}
+		return result
+	case error:
+		if text := v.Error(); s.scrubString(text) != text {
+			return s.scrubString(text)
+		}
+	case fmt.Stringer:
+		if text := v.String(); s.scrubString(text) != text {
+			return s.scrubString(text)
+		}
+	}
+
+	return value
+}
+
+func (s *scrubber) scrubString(value string) string {
+	for _, pattern := range s.values {
+		if pattern == ScrubCardNumbers {
+			value = pattern.ReplaceAllStringFunc(value, func(match string) string {
+				if luhn(match) {
+					return Redacted
+				}
+				return match
+			})
+			continue
+		}
+		value = pattern.ReplaceAllString(value, Redacted)
+	}
+	return value
+}
+
+func (s *scrubber) hash(value string) string {
+	mac := hmac.New(sha256.New, []byte(s.salt))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func matchAny(patterns []*regexp.Regexp, s string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// luhn reports whether the digits in s pass the Luhn checksum used by card
+// numbers. Non-digit characters are ignored.
+func luhn(s string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return len(digits) > 0 && sum%10 == 0
+}
@@ -0,0 +1,83 @@
+package bt
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrubber(t *testing.T) {
+	s := newScrubber(ScrubOptions{
+		AllowKeys:     []*regexp.Regexp{regexp.MustCompile(`^token_count$`)},
+		HashMachineID: true,
+		MachineIDSalt: "salt",
+	})
+
+	env := map[string]string{
+		"DATABASE_PASSWORD": "hunter2",
+		"GITHUB_TOKEN":      "ghp_123",
+		"PGPASSWORD":        "hunter2",
+		"DATABASE_URL":      "postgres://admin:hunter2@db:5432/app",
+		"CONFIG":            "a=b=c",
+	}
+	attributes := map[string]interface{}{
+		"error.message": "charge for jane@example.com with 4111 1111 1111 1111 failed (order 1700000000000)",
+		"api_key":       "abc",
+		"token_count":   42,
+		"guid":          "machine-id",
+		"hostname":      "build-01",
+		"request":       map[string]interface{}{"Authorization": "Bearer abc.def", "path": "/?token=secret&page=2"},
+	}
+	annotations := map[string]interface{}{"Environment Variables": env}
+
+	s.scrubAttributes(attributes)
+	s.scrubAnnotations(annotations)
+
+	assert.Equal(t, "charge for [REDACTED] with [REDACTED] failed (order 1700000000000)", attributes["error.message"])
+	assert.Equal(t, Redacted, attributes["api_key"])
+	assert.Equal(t, 42, attributes["token_count"])
+	assert.Equal(t, s.hash("machine-id"), attributes["guid"])
+	assert.Equal(t, s.hash("build-01"), attributes["hostname"])
+	assert.NotEqual(t, newScrubber(ScrubOptions{HashMachineID: true, MachineIDSalt: "other"}).hash("build-01"), attributes["hostname"])
+	assert.Equal(t, map[string]interface{}{"Authorization": Redacted, "path": "/?[REDACTED]&page=2"}, attributes["request"])
+
+	assert.Equal(t, map[string]string{
+		"DATABASE_PASSWORD": Redacted,
+		"GITHUB_TOKEN":      Redacted,
+		"PGPASSWORD":        Redacted,
+		"DATABASE_URL":      "postgres[REDACTED]db:5432/app",
+		"CONFIG":            "a=b=c",
+	}, annotations["Environment Variables"])
+
+	// The application's map is left alone.
+	assert.Equal(t, "hunter2", env["DATABASE_PASSWORD"])
+
+	disabled := newScrubber(ScrubOptions{Disabled: true})
+	attributes = map[string]interface{}{"password": "hunter2"}
+	disabled.scrubAttributes(attributes)
+	assert.Equal(t, "hunter2", attributes["password"])
+}
+
+func TestDefaultScrubDenyKeys(t *testing.T) {
+	for _, key := range []string{
+		"password", "DATABASE_PASSWORD", "db.passwd", "client_secret", "GITHUB_TOKEN",
+		"x-api-key", "apiKey", "auth", "x-auth-token", "Authorization", "aws_credentials",
+		"private_key", "set-cookie", "session_id", "sentry.dsn",
+		"PGPASSWORD", "MYSQL_PWD", "ACCESSTOKEN", "SECRETKEY", "accessToken", "clientSecret",
+	} {
+		assert.True(t, matchAny(DefaultScrubDenyKeys, key), key)
+	}
+
+	for _, key := range []string{
+		"author", "oauth.provider", "tokens_used", "tokenizer", "secretary", "passwordless_enabled",
+		"cookies_accepted", "authority", "dsnless",
+	} {
+		assert.False(t, matchAny(DefaultScrubDenyKeys, key), key)
+	}
+}
+
+func TestGetEnvVars(t *testing.T) {
+	t.Setenv("BT_TEST_VALUE", "a=b=c")
+	assert.Equal(t, "a=b=c", getEnvVars()["BT_TEST_VALUE"])
+}
@@ -0,0 +1,189 @@
+package bt
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// SlogHandlerOptions configures a SlogHandler.
+type SlogHandlerOptions struct {
+	// Client sends the reports.
+	//
+	// Defaults to the default client.
+	Client *Client
+
+	// Level is the minimum level of the records reported.
+	//
+	// Defaults to slog.LevelError.
+	Level slog.Leveler
+}
+
+// SlogHandler is a slog.Handler forwarding every record to another handler
+// and reporting those at or above a level.
+//
+// The attributes of a reported record, including those added with WithAttrs,
+// become report attributes, named after their groups like "group.key". If an
+// attribute holds an error, that error is reported, and the message of the
+// record is sent as the log.message attribute. Otherwise the message of the
+// record is reported. The stack of the report is the one of the logging call.
+// Records are reported with ReportContext, so the attributes carried by the
+// context of the logging call are added too.
+type SlogHandler struct {
+	inner  slog.Handler
+	client *Client
+	level  slog.Leveler
+	attrs  map[string]interface{}
+	err    error  // The first error found in attrs.
+	prefix string // Group prefix of the attributes added next.
+}
+
+// NewSlogHandler returns a SlogHandler forwarding records to inner. options
+// may be nil.
+func NewSlogHandler(inner slog.Handler, options *SlogHandlerOptions) *SlogHandler {
+	h := &SlogHandler{inner: inner, client: defaultClient, level: slog.LevelError}
+	if options != nil {
+		if options.Client != nil {
+			h.client = options.Client
+		}
+		if options.Level != nil {
+			h.level = options.Level
+		}
+	}
+
+	return h
+}
+
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() || h.inner.Enabled(ctx, level)
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= h.level.Level() {
+		h.report(ctx, record)
+	}
+
+	if !h.inner.Enabled(ctx, record.Level) {
+		return nil
+	}
+	return h.inner.Handle(ctx, record)
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	h2 := h.clone()
+	h2.inner = h.inner.WithAttrs(attrs)
+	for _, attr := range attrs {
+		h2.addAttr(h2.attrs, &h2.err, h2.prefix, attr)
+	}
+	return h2
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := h.clone()
+	h2.inner = h.inner.WithGroup(name)
+	h2.prefix = h.prefix + name + "."
+	return h2
+}
+
+func (h *SlogHandler) clone() *SlogHandler {
+	h2 := *h
+	h2.attrs = make(map[string]interface{}, len(h.attrs))
+	for k, v := range h.attrs {
+		h2.attrs[k] = v
+	}
+	return &h2
+}
+
+func (h *SlogHandler) report(ctx context.Context, record slog.Record) {
+	attributes := make(map[string]interface{}, len(h.attrs)+record.NumAttrs()+2)
+	for k, v := range h.attrs {
+		attributes[k] = v
+	}
+	err := h.err
+	record.Attrs(func(attr slog.Attr) bool {
+		h.addAttr(attributes, &err, h.prefix, attr)
+		return true
+	})
+	attributes["log.level"] = record.Level.String()
+
+	var options []ReportOption
+	if pcs := callersFrom(record.PC); pcs != nil {
+		options = append(options, withCallers(pcs))
+	}
+
+	if err != nil {
+		attributes["log.message"] = record.Message
+		h.client.ReportContext(ctx, err, attributes, options...)
+	} else {
+		h.client.ReportContext(ctx, record.Message, attributes, options...)
+	}
+}
+
+// addAttr adds attr to attributes, flattening groups. The first error found
+// is stored in err rather than added.
+func (h *SlogHandler) addAttr(attributes map[string]interface{}, err *error, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+
+	if value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, a := range value.Group() {
+			h.addAttr(attributes, err, prefix, a)
+		}
+		return
+	}
+
+	if e, ok := value.Any().(error); ok && e != nil && *err == nil {
+		*err = e
+		return
+	}
+	if attr.Key == "" {
+		return
+	}
+
+	key := prefix + attr.Key
+	switch value.Kind() {
+	case slog.KindString:
+		attributes[key] = value.String()
+	case slog.KindInt64:
+		attributes[key] = value.Int64()
+	case slog.KindUint64:
+		attributes[key] = value.Uint64()
+	case slog.KindFloat64:
+		attributes[key] = value.Float64()
+	case slog.KindBool:
+		attributes[key] = value.Bool()
+	case slog.KindDuration:
+		attributes[key] = value.Duration().String()
+	case slog.KindTime:
+		attributes[key] = value.Time().Format(time.RFC3339Nano)
+	default:
+		attributes[key] = fmt.Sprint(value.Any())
+	}
+}
+
+// callersFrom returns the stack of the calling goroutine from the frame
+// whose program counter is pc, or nil if there is no such frame.
+func callersFrom(pc uintptr) []uintptr {
+	if pc == 0 {
+		return nil
+	}
+
+	pcs := callers()
+	for i, p := range pcs {
+		if p == pc {
+			return pcs[i:]
+		}
+	}
+	return nil
+}
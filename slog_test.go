@@ -0,0 +1,58 @@
+package bt
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogHandler(t *testing.T) {
+	client, recorder := newTestClient(t, OptionsStruct{})
+	var logs bytes.Buffer
+	inner := slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelInfo})
+
+	logger := slog.New(NewSlogHandler(inner, &SlogHandlerOptions{Client: client, Level: slog.LevelWarn}))
+	logger = logger.With("service", "api").WithGroup("request")
+
+	logger.Debug("not logged")
+	logger.Info("logged only", "id", 1)
+	logger.Warn("slow request", "id", 2, "elapsed", 1500*time.Millisecond)
+	logger.Error("request failed", "id", 3, slog.Group("user", "admin", true), "err", errors.New("connection reset"))
+	client.FinishSendingReports()
+
+	assert.Contains(t, logs.String(), "logged only")
+	assert.Contains(t, logs.String(), "slow request")
+	assert.Contains(t, logs.String(), "request failed")
+	assert.NotContains(t, logs.String(), "not logged")
+
+	recorder.m.Lock()
+	defer recorder.m.Unlock()
+	if !assert.Len(t, recorder.reports, 2) {
+		return
+	}
+
+	attributes := recorder.reports[0]["attributes"].(map[string]interface{})
+	assert.Equal(t, "slow request", attributes["error.message"])
+	assert.Equal(t, "WARN", attributes["log.level"])
+	assert.Equal(t, "api", attributes["service"])
+	assert.Equal(t, float64(2), attributes["request.id"])
+	assert.Equal(t, "1.5s", attributes["request.elapsed"])
+	assert.Equal(t, []interface{}{"message"}, recorder.reports[0]["classifiers"])
+
+	attributes = recorder.reports[1]["attributes"].(map[string]interface{})
+	assert.Equal(t, "connection reset", attributes["error.message"])
+	assert.Equal(t, "request failed", attributes["log.message"])
+	assert.Equal(t, "ERROR", attributes["log.level"])
+	assert.Equal(t, true, attributes["request.user.admin"])
+	assert.Nil(t, attributes["request.err"])
+	assert.Equal(t, []interface{}{"*errors.errorString"}, recorder.reports[1]["classifiers"])
+
+	// The stack starts at the logging call.
+	threads := recorder.reports[1]["threads"].(map[string]interface{})
+	frame := threads["0"].(map[string]interface{})["stack"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "TestSlogHandler", frame["funcName"])
+}
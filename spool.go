@@ -0,0 +1,188 @@
+package bt
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSpoolMaxSize = 50 * 1024 * 1024
+	defaultSpoolMaxAge  = 24 * time.Hour
+
+	spoolSuffix     = ".json"
+	spoolTempSuffix = ".tmp"
+
+	// Temporary files younger than this may still be written by another
+	// client sharing the directory and are left alone during cleanup.
+	spoolTempGracePeriod = time.Minute
+)
+
+// spool stores serialized reports on disk until they are uploaded. Reports
+// with attachments are stored as their multipart body, despite the suffix;
+// see uploadContentType.
+//
+// Reports are written to a temporary file which is synced and then renamed
+// into place, so a crash partway through a write leaves at most a stray
+// temporary file behind and never a truncated report.
+type spool struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+
+	m sync.Mutex
+}
+
+type spoolEntry struct {
+	path string
+	size int64
+}
+
+func newSpool(dir string, maxSize int64, maxAge time.Duration) *spool {
+	if maxSize <= 0 {
+		maxSize = defaultSpoolMaxSize
+	}
+	if maxAge <= 0 {
+		maxAge = defaultSpoolMaxAge
+	}
+
+	return &spool{dir: dir, maxSize: maxSize, maxAge: maxAge}
+}
+
+// write stores the report and returns the path of the spooled file. Older
+// reports are removed as needed to keep the spool within its size cap.
+func (s *spool) write(report []byte) (string, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if int64(len(report)) > s.maxSize {
+		return "", fmt.Errorf("report of %d bytes exceeds spool size limit", len(report))
+	}
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return "", err
+	}
+
+	if _, err := s.prune(int64(len(report))); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, "report-*"+spoolTempSuffix)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed.
+
+	if _, err := tmp.Write(report); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d-%s%s", time.Now().UnixNano(), createUuid(), spoolSuffix))
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// remove deletes a spooled report, typically after it has been uploaded.
+func (s *spool) remove(path string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// pending returns the spooled reports, oldest first, after removing expired
+// reports and stale temporary files.
+func (s *spool) pending() ([]string, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	entries, err := s.prune(0)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		paths = append(paths, entry.path)
+	}
+	return paths, nil
+}
+
+func (s *spool) read(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// prune enforces the age and size caps, reserving room for a new report of
+// the specified size. It returns the remaining reports, oldest first.
+// The caller must hold s.m.
+func (s *spool) prune(reserve int64) ([]spoolEntry, error) {
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	entries := []spoolEntry{}
+	total := int64(0)
+
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() {
+			continue
+		}
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(s.dir, dirEntry.Name())
+
+		switch {
+		case strings.HasSuffix(dirEntry.Name(), spoolTempSuffix):
+			// Left behind by a crash partway through a write.
+			if now.Sub(info.ModTime()) > spoolTempGracePeriod {
+				_ = os.Remove(path)
+			}
+		case strings.HasSuffix(dirEntry.Name(), spoolSuffix):
+			if now.Sub(info.ModTime()) > s.maxAge {
+				_ = os.Remove(path)
+				continue
+			}
+			entries = append(entries, spoolEntry{path: path, size: info.Size()})
+			total += info.Size()
+		}
+	}
+
+	// File names start with the creation time, so they sort oldest first.
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].path < entries[j].path
+	})
+
+	for len(entries) > 0 && total+reserve > s.maxSize {
+		_ = os.Remove(entries[0].path)
+		total -= entries[0].size
+		entries = entries[1:]
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,166 @@
+package bt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpoolPrune(t *testing.T) {
+	dir := t.TempDir()
+	s := newSpool(dir, 10, time.Hour)
+
+	first, err := s.write([]byte("12345"))
+	assert.NoError(t, err)
+	second, err := s.write([]byte("67890"))
+	assert.NoError(t, err)
+
+	// The oldest report makes room for the new one.
+	third, err := s.write([]byte("abc"))
+	assert.NoError(t, err)
+
+	pending, err := s.pending()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{second, third}, pending)
+	assert.NoFileExists(t, first)
+
+	_, err = s.write([]byte("this report is too large"))
+	assert.Error(t, err)
+
+	old := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(second, old, old))
+
+	stale := filepath.Join(dir, "report-1"+spoolTempSuffix)
+	assert.NoError(t, os.WriteFile(stale, []byte("partial"), 0600))
+	assert.NoError(t, os.Chtimes(stale, old, old))
+
+	pending, err = s.pending()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{third}, pending)
+	assert.NoFileExists(t, stale)
+}
+
+func TestClientSpoolsFailedReports(t *testing.T) {
+	var available atomic.Bool
+	recorder := &reportRecorder{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		recorder.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	options := OptionsStruct{
+		Endpoint: server.URL,
+		Token:    "fake token",
+		SpoolDir: dir,
+	}
+
+	client := NewClient(options)
+	client.Report(errors.New("while offline"), nil)
+	client.FinishSendingReports()
+
+	pending, err := newSpool(dir, 0, 0).pending()
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Empty(t, recorder.attributes())
+
+	// A new client uploads the spooled report at start-up.
+	available.Store(true)
+	client = NewClient(options)
+	client.Report(errors.New("while online"), nil)
+	client.FinishSendingReports()
+
+	attributes := recorder.attributes()
+	if assert.Len(t, attributes, 2) {
+		assert.Equal(t, "while offline", attributes[0]["error.message"])
+		assert.Equal(t, "while online", attributes[1]["error.message"])
+	}
+
+	pending, err = newSpool(dir, 0, 0).pending()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestDefaultClientReplaysSpool(t *testing.T) {
+	client, recorder := newTestClient(t, OptionsStruct{})
+	client.FinishSendingReports()
+
+	dir := t.TempDir()
+	_, err := newSpool(dir, 0, 0).write([]byte(`{"attributes": {"error.message": "left over"}}`))
+	assert.NoError(t, err)
+
+	// The default client is created with newClient and set up on first use,
+	// rather than by NewClient.
+	options := *client.options
+	options.SpoolDir = dir
+	client = newClient(&options)
+	defer client.FinishSendingReports()
+
+	_, err = client.Flush(context.Background())
+	assert.NoError(t, err)
+
+	attributes := recorder.attributes()
+	if assert.Len(t, attributes, 1) {
+		assert.Equal(t, "left over", attributes[0]["error.message"])
+	}
+
+	pending, err := newSpool(dir, 0, 0).pending()
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestFlushDoesNotWaitForSpoolReplay(t *testing.T) {
+	var available atomic.Bool
+	release := make(chan struct{})
+	recorder := &reportRecorder{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if bytes.Contains(body, []byte(`"error.message":"while offline"`)) {
+			// The replay of the spool is stuck.
+			<-release
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		recorder.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	client := NewClient(OptionsStruct{
+		Endpoint: server.URL,
+		Token:    "fake token",
+		SpoolDir: t.TempDir(),
+	})
+	defer client.FinishSendingReports()
+	defer close(release)
+
+	client.Report(errors.New("while offline"), nil)
+	_, err := client.Flush(context.Background())
+	assert.NoError(t, err)
+
+	available.Store(true)
+	client.Report(errors.New("while online"), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := client.Flush(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Sent)
+}
@@ -0,0 +1,173 @@
+package bt
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultMaxThreadsSize = 1 << 20
+
+// collapseThreads groups the threads parsed from a stack trace of all
+// goroutines by wait state and stack, as many goroutines usually wait in the
+// same place. Each group is represented by its first thread, which records the
+// number of goroutines and their IDs.
+//
+// The threads named in keep, such as the faulting one, are never grouped nor
+// left out. The groups follow in the order of the stack trace, until their size
+// goes over maxSize bytes. Source code is optional, so it only gets what is
+// left of maxSize, see sourceFiles.fit.
+//
+// The groups are keyed by their index, after the kept threads. The number of
+// goroutines left out is returned.
+func collapseThreads(threads map[string]Thread, keep []string, sources *sourceFiles, maxSize int) (map[string]Thread, int) {
+	if maxSize <= 0 {
+		maxSize = defaultMaxThreadsSize
+	}
+
+	result := make(map[string]Thread, len(keep))
+	var ordered []Thread // Threads of result, by priority.
+	size := 0
+	add := func(name string, thread Thread) {
+		b, _ := json.Marshal(thread)
+		size += len(b)
+		result[name] = thread
+		ordered = append(ordered, thread)
+	}
+
+	kept := map[string]bool{}
+	for _, name := range keep {
+		kept[name] = true
+		if thread, ok := threads[name]; ok {
+			add(name, thread)
+		}
+	}
+
+	var groups []Thread
+	index := map[string]int{} // key: stack signature, value: index in groups.
+	for _, name := range threadNames(threads) {
+		if kept[name] {
+			continue
+		}
+
+		thread := threads[name]
+		signature := stackSignature(thread)
+		i, ok := index[signature]
+		if !ok {
+			index[signature] = len(groups)
+			groups = append(groups, thread)
+			continue
+		}
+
+		group := &groups[i]
+		if group.Count == 0 {
+			group.Count = 1
+			group.GoroutineIDs = []int64{group.GoroutineID}
+		}
+		group.Count++
+		group.GoroutineIDs = append(group.GoroutineIDs, thread.GoroutineID)
+		if thread.WaitMinutes > group.WaitMinutes {
+			group.WaitMinutes = thread.WaitMinutes
+		}
+	}
+
+	omitted := 0
+	key := 0
+	for _, group := range groups {
+		if group.Count > 1 {
+			group.Name = fmt.Sprintf("%d goroutines [%s]", group.Count, group.State)
+		}
+
+		if size >= maxSize {
+			omitted += max(group.Count, 1)
+			continue
+		}
+
+		for kept[strconv.Itoa(key)] {
+			key++
+		}
+		add(strconv.Itoa(key), group)
+		key++
+	}
+
+	sources.retain(result)
+	sources.fit(ordered, maxSize-size)
+	return result, omitted
+}
+
+// threadNames returns the names of threads, with the numbered threads first,
+// in the order of the stack trace they were parsed from.
+func threadNames(threads map[string]Thread) []string {
+	names := make([]string, 0, len(threads))
+	for name := range threads {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, errA := strconv.Atoi(names[i])
+		b, errB := strconv.Atoi(names[j])
+		switch {
+		case errA == nil && errB == nil:
+			return a < b
+		case errA == nil || errB == nil:
+			return errA == nil
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// stackSignature identifies the goroutines with the same wait state and stack.
+// Arguments are left out, as they differ for goroutines doing the same thing.
+func stackSignature(thread Thread) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\x00%t", thread.State, thread.LockedToThread)
+	for _, frame := range thread.Stacks {
+		fmt.Fprintf(&b, "\x00%s.%s %s:%s", frame.Library, frame.FuncName, frame.SourceCodeID, frame.Line)
+	}
+	return b.String()
+}
+
+// retain removes the source code not referenced by threads. The IDs of the
+// files are kept, so id must not be called afterwards.
+func (s *sourceFiles) retain(threads map[string]Thread) {
+	referenced := map[string]bool{}
+	for _, thread := range threads {
+		for _, frame := range thread.Stacks {
+			referenced[frame.SourceCodeID] = true
+		}
+	}
+
+	for id := range s.codes {
+		if !referenced[id] {
+			delete(s.codes, id)
+		}
+	}
+}
+
+// fit leaves out the text of the source files which don't fit in
+// budget bytes, keeping the files referenced by the first threads first.
+func (s *sourceFiles) fit(threads []Thread, budget int) {
+	seen := map[string]bool{}
+	for _, thread := range threads {
+		for _, frame := range thread.Stacks {
+			id := frame.SourceCodeID
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			code, ok := s.codes[id]
+			if !ok {
+				continue
+			}
+			if size := len(code.Text) + len(code.Path); size <= budget {
+				budget -= size
+				continue
+			}
+			// Same as for a file that can't be read.
+			s.codes[id] = SourceCode{Path: code.Path}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package bt
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollapseThreads(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("goroutine 1 [running]:\nmain.main()\n\t/tmp/main.go:10 +0x1\n")
+	for i, wait := range []string{"", ", 2 minutes", ", 5 minutes"} {
+		b.WriteString("\ngoroutine " + string(rune('2'+i)) + " [chan receive" + wait + "]:\n" +
+			"main.worker(0xc00001" + string(rune('0'+i)) + ")\n\t/tmp/worker.go:20 +0x1\n" +
+			"created by main.main in goroutine 1\n\t/tmp/main.go:8 +0x2\n")
+	}
+	b.WriteString("\ngoroutine 5 [select]:\nmain.serve()\n\t/tmp/serve.go:30 +0x1\n")
+
+	sources := newSourceFiles(4)
+	threads := parseThreads([]byte(b.String()), 0, sources)
+	collapsed, omitted := collapseThreads(threads, []string{"0", "origin"}, sources, 0)
+	assert.Equal(t, 0, omitted)
+	if !assert.Len(t, collapsed, 3) {
+		return
+	}
+
+	assert.Equal(t, threads["0"], collapsed["0"])
+
+	group := collapsed["1"]
+	assert.Equal(t, "3 goroutines [chan receive]", group.Name)
+	assert.Equal(t, 3, group.Count)
+	assert.Equal(t, []int64{2, 3, 4}, group.GoroutineIDs)
+	assert.Equal(t, 5, group.WaitMinutes)
+	assert.Equal(t, "0xc000010", group.Stacks[0].Arguments)
+
+	assert.Equal(t, "goroutine 5 [select]", collapsed["2"].Name)
+	assert.Zero(t, collapsed["2"].Count)
+	assert.Len(t, sources.codes, 3)
+
+	// Only the faulting goroutine and the first group fit.
+	sources = newSourceFiles(4)
+	threads = parseThreads([]byte(b.String()), 0, sources)
+	faulting, _ := json.Marshal(threads["0"])
+	collapsed, omitted = collapseThreads(threads, []string{"0", "origin"}, sources, len(faulting)+1)
+	assert.Equal(t, 1, omitted)
+	assert.Len(t, collapsed, 2)
+	assert.Equal(t, 3, collapsed["1"].Count)
+	assert.Len(t, sources.codes, 2)
+	assert.NotContains(t, sources.codes, sources.ids["/tmp/serve.go"])
+}
+
+func TestCollapseThreadsSourceBudget(t *testing.T) {
+	dir := t.TempDir()
+	large := filepath.Join(dir, "large.go")
+	small := filepath.Join(dir, "small.go")
+	assert.NoError(t, os.WriteFile(large, bytes.Repeat([]byte("// comment\n"), 10000), 0600))
+	assert.NoError(t, os.WriteFile(small, []byte("package main\n"), 0600))
+
+	stackTrace := "goroutine 1 [running]:\nmain.main()\n\t" + large + ":10 +0x1\n" +
+		"\ngoroutine 2 [select]:\nmain.serve()\n\t" + small + ":1 +0x1\n" +
+		"\ngoroutine 3 [chan receive]:\nmain.worker()\n\t" + small + ":1 +0x1\n"
+
+	// The source files don't take the room of the threads.
+	sources := newSourceFiles(4)
+	threads := parseThreads([]byte(stackTrace), 0, sources)
+	collapsed, omitted := collapseThreads(threads, []string{"0", "origin"}, sources, 4096)
+	assert.Equal(t, 0, omitted)
+	assert.Len(t, collapsed, 3)
+
+	assert.Equal(t, SourceCode{Path: large}, sources.codes[sources.ids[large]])
+	assert.Equal(t, "package main\n", sources.codes[sources.ids[small]].Text)
+}
+
+func TestClientReportCollapsesGoroutines(t *testing.T) {
+	client, recorder := newTestClient(t, OptionsStruct{CaptureAllGoroutines: true})
+
+	// The frames of this package are left out of the stacks of other
+	// goroutines, so they wait in sync instead.
+	var release sync.WaitGroup
+	release.Add(1)
+	defer release.Done()
+	for i := 0; i < 50; i++ {
+		go release.Wait()
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	client.Report("message", nil)
+	client.FinishSendingReports()
+
+	recorder.m.Lock()
+	defer recorder.m.Unlock()
+	if !assert.Len(t, recorder.reports, 1) {
+		return
+	}
+
+	threads := recorder.reports[0]["threads"].(map[string]interface{})
+	assert.Less(t, len(threads), 50)
+
+	found := false
+	for _, thread := range threads {
+		thread := thread.(map[string]interface{})
+		if count, _ := thread["count"].(float64); count >= 50 {
+			found = true
+			assert.Len(t, thread["goroutineIds"], int(count))
+			assert.Regexp(t, `^\d+ goroutines \[.+\]$`, thread["name"])
+		}
+	}
+	assert.True(t, found)
+}
@@ -3,6 +3,9 @@ package bt
 import (
 	"fmt"
 	"os"
+	"reflect"
+	"runtime"
+	"strconv"
 	"strings"
 )
 
@@ -10,13 +13,41 @@ type Thread struct {
 	Name   string       `json:"name"`
 	Fault  bool         `json:"fault"`
 	Stacks []StackFrame `json:"stack"`
+
+	// Parsed from the header and "created by" line of a goroutine in a
+	// stack trace, such as
+	//
+	//	goroutine 7 [chan receive, 5 minutes, locked to thread]:
+	//	...
+	//	created by main.main in goroutine 1
+	GoroutineID       int64  `json:"goroutineId,omitempty"`
+	State             string `json:"state,omitempty"`       // "chan receive"
+	WaitMinutes       int    `json:"waitMinutes,omitempty"` // Only reported from 1 minute.
+	LockedToThread    bool   `json:"lockedToThread,omitempty"`
+	CreatedBy         string `json:"createdBy,omitempty"` // "main.main"
+	ParentGoroutineID int64  `json:"parentGoroutineId,omitempty"`
+
+	// Set if the thread represents Count goroutines with the same wait state
+	// and stack, see OptionsStruct.MaxThreadsSize.
+	Count        int     `json:"count,omitempty"`
+	GoroutineIDs []int64 `json:"goroutineIds,omitempty"`
 }
 
 type StackFrame struct {
-	FuncName      string `json:"funcName"`
-	Library       string `json:"library"`
-	SourceCodeID  string `json:"sourceCode"`
-	Line          string `json:"line"`
+	FuncName     string `json:"funcName"`
+	Library      string `json:"library"`
+	SourceCodeID string `json:"sourceCode"`
+	Line         string `json:"line"`
+
+	// Only set for frames parsed from a stack trace: the words of the
+	// arguments as printed by the runtime, e.g. "0xc000012345, {0x1, 0x2}".
+	Arguments string `json:"arguments,omitempty"`
+
+	// Only set for frames captured with runtime.Callers, which is the case
+	// for the goroutine sending the report.
+	Address string `json:"address,omitempty"` // Program counter.
+	Inlined bool   `json:"inlined,omitempty"` // Inlined into the next frame.
+
 	skipBacktrace bool
 }
 
@@ -30,19 +61,91 @@ type SourceCode struct {
 }
 
 func ParseThreadsFromStack(stackTrace []byte) (map[string]Thread, map[string]SourceCode) {
-	splitThreads := strings.Split(string(stackTrace), "\n\n")
+	return parseThreadsFromStack(stackTrace, Options.TabWidth)
+}
+
+func parseThreadsFromStack(stackTrace []byte, tabWidth int) (map[string]Thread, map[string]SourceCode) {
+	sources := newSourceFiles(tabWidth)
+	threads := parseThreads(stackTrace, 0, sources)
+	return threads, sources.codes
+}
+
+// Maximum number of frames captured for the goroutine sending a report.
+const maxReportFrames = 128
+
+// packagePath is the import path of this package. It differs from
+// github.com/backtrace-labs/backtrace-go if the package is vendored or
+// forked.
+var packagePath = strings.TrimSuffix(runtime.FuncForPC(reflect.ValueOf(stack).Pointer()).Name(), ".stack")
+
+// callers returns the program counters of the stack of the calling
+// goroutine, starting with its caller.
+func callers() []uintptr {
+	pcs := make([]uintptr, maxReportFrames)
+	n := runtime.Callers(2, pcs)
+	return pcs[:n:n]
+}
+
+// currentGoroutine returns the header of the stack trace of the calling
+// goroutine, such as "goroutine 1 [running]".
+func currentGoroutine() string {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	header, _, _ := strings.Cut(string(buf[:n]), "\n")
+	return strings.TrimSuffix(header, ":")
+}
+
+// isPackageFunction reports whether function, as named by runtime.Frame,
+// belongs to this package or one of its subpackages. The tests of the
+// package are not part of it.
+func isPackageFunction(function, file string) bool {
+	return (strings.HasPrefix(function, packagePath+".") || strings.HasPrefix(function, packagePath+"/")) &&
+		!strings.HasSuffix(file, "_test.go")
+}
+
+// sourceFiles collects the source files referenced by the frames of a report.
+type sourceFiles struct {
+	tabWidth int
+	ids      map[string]string     // key: path, value: unique path number starting from 0.
+	codes    map[string]SourceCode // key: unique path number starting from 0.
+}
 
-	sourceCodeID := 0
+func newSourceFiles(tabWidth int) *sourceFiles {
+	return &sourceFiles{
+		tabWidth: tabWidth,
+		ids:      make(map[string]string),
+		codes:    make(map[string]SourceCode),
+	}
+}
+
+// id returns the source code ID of the file at path, reading it the first
+// time.
+func (s *sourceFiles) id(path string) string {
+	if id, ok := s.ids[path]; ok {
+		return id
+	}
+
+	id := fmt.Sprintf("%d", len(s.ids))
+	s.ids[path] = id
+	s.codes[id] = readFileGetSourceCode(path, s.tabWidth)
+	return id
+}
+
+// parseThreads parses a stack trace in the format of runtime.Stack. Threads
+// are keyed by their index in the trace, plus first; thread 0 is the
+// faulting one.
+func parseThreads(stackTrace []byte, first int, sources *sourceFiles) map[string]Thread {
+	splitThreads := strings.Split(string(stackTrace), "\n\n")
 
-	sourcesPath := make(map[string]int)        // key: path, value: unique path number starting from 0.
-	threads := make(map[string]Thread)         // key: index of split string, starting from 0.
-	sourceCodes := make(map[string]SourceCode) // key: unique path number starting from 0.
+	threads := make(map[string]Thread) // key: index of split string, starting from first.
 
-	for threadID, stackText := range splitThreads {
+	for i, stackText := range splitThreads {
+		threadID := first + i
 		lines := strings.Split(stackText, "\n")
 
 		sf := StackFrame{}
-		thread := Thread{Name: strings.TrimSuffix(lines[0], ":"), Fault: threadID == 0}
+		thread := newThread(lines[0])
+		thread.Fault = threadID == 0
 		for i := 1; i < len(lines); i++ {
 			line := strings.TrimSpace(lines[i])
 			if line == "" {
@@ -50,8 +153,12 @@ func ParseThreadsFromStack(stackTrace []byte) (map[string]Thread, map[string]Sou
 			}
 
 			if i%2 != 0 { // odd lines are function paths
+				if creator, parent, ok := parseCreatedBy(line); ok {
+					thread.CreatedBy = creator
+					thread.ParentGoroutineID = parent
+				}
 				line = trimCreatedBy(line)
-				if strings.HasPrefix(line, "github.com/backtrace-labs/backtrace-go") {
+				if strings.HasPrefix(line, packagePath) {
 					sf.skipBacktrace = true
 					continue
 				}
@@ -67,6 +174,7 @@ func ParseThreadsFromStack(stackTrace []byte) (map[string]Thread, map[string]Sou
 
 				sf.FuncName = function
 				sf.Library = line[:lastIndex]
+				sf.Arguments = frameArguments(line)
 			} else {
 				if sf.skipBacktrace {
 					continue
@@ -78,18 +186,7 @@ func ParseThreadsFromStack(stackTrace []byte) (map[string]Thread, map[string]Sou
 				path := ""
 				path, sf.Line, _ = strings.Cut(line, ":")
 
-				if scID, ok := sourcesPath[path]; ok {
-					sf.SourceCodeID = fmt.Sprintf("%d", scID)
-				} else {
-					strSourceCodeID := fmt.Sprintf("%d", sourceCodeID)
-					sourcesPath[path] = sourceCodeID
-
-					sourceCodes[strSourceCodeID] = readFileGetSourceCode(path)
-
-					sf.SourceCodeID = strSourceCodeID
-
-					sourceCodeID++
-				}
+				sf.SourceCodeID = sources.id(path)
 				thread.Stacks = append(thread.Stacks, sf)
 				sf = StackFrame{}
 			}
@@ -100,10 +197,52 @@ func ParseThreadsFromStack(stackTrace []byte) (map[string]Thread, map[string]Sou
 		}
 	}
 
-	return threads, sourceCodes
+	return threads
+}
+
+// threadFromCallers builds a thread from program counters, as returned by
+// runtime.Callers. If skipPackage is set, the leading frames belonging to
+// this package are left out.
+func threadFromCallers(name string, pcs []uintptr, skipPackage bool, sources *sourceFiles) Thread {
+	thread := newThread(name)
+
+	frames := runtime.CallersFrames(pcs)
+	for more := len(pcs) > 0; more; {
+		var frame runtime.Frame
+		frame, more = frames.Next()
+		if frame.Function == "" || frame.Function == "runtime.goexit" {
+			continue
+		}
+		if skipPackage {
+			if isPackageFunction(frame.Function, frame.File) {
+				continue
+			}
+			skipPackage = false
+		}
+
+		sf := StackFrame{
+			SourceCodeID: sources.id(frame.File),
+			Line:         fmt.Sprintf("%d", frame.Line),
+			Address:      fmt.Sprintf("0x%x", frame.PC),
+			// The Func of inlined frames is nil.
+			Inlined: frame.Func == nil,
+		}
+		if frame.Function == "runtime.gopanic" {
+			// As printed in stack traces.
+			sf.FuncName = "panic"
+			sf.Library = "runtime"
+		} else {
+			lastIndex, function := getLastPathIndexAndFunction(frame.Function)
+			sf.FuncName = function
+			sf.Library = frame.Function[:max(lastIndex, 0)]
+		}
+		thread.Stacks = append(thread.Stacks, sf)
+	}
+
+	return thread
 }
 
-func readFileGetSourceCode(path string) SourceCode {
+func readFileGetSourceCode(path string, tabWidth int) SourceCode {
 	sc := SourceCode{}
 	bytes, err := os.ReadFile(path)
 	if err == nil {
@@ -111,7 +250,7 @@ func readFileGetSourceCode(path string) SourceCode {
 		sc.StartLine = 1
 		sc.StartColumn = 1
 		sc.StartPos = 0
-		sc.TabWidth = Options.TabWidth
+		sc.TabWidth = tabWidth
 	}
 	sc.Path = path
 
@@ -131,6 +270,105 @@ func getLastPathIndexAndFunction(line string) (int, string) {
 	return lastIndex, function
 }
 
+// newThread returns a thread named after header. If header is a goroutine
+// header, such as "goroutine 7 [chan receive, 5 minutes]:", the fields
+// describing the goroutine are set from it.
+func newThread(header string) Thread {
+	thread := Thread{Name: strings.TrimSuffix(header, ":")}
+
+	rest, ok := strings.CutPrefix(thread.Name, "goroutine ")
+	if !ok {
+		return thread
+	}
+	id, rest, _ := strings.Cut(rest, " ")
+	thread.GoroutineID, _ = strconv.ParseInt(id, 10, 64)
+
+	// Skip the gp=, m=, ... fields printed with GOTRACEBACK=system.
+	start, end := strings.Index(rest, "["), strings.LastIndex(rest, "]")
+	if start < 0 || end < start {
+		return thread
+	}
+	for i, field := range strings.Split(rest[start+1:end], ", ") {
+		switch {
+		case i == 0:
+			thread.State = field
+		case field == "locked to thread":
+			thread.LockedToThread = true
+		case strings.HasSuffix(field, " minutes"):
+			thread.WaitMinutes, _ = strconv.Atoi(strings.TrimSuffix(field, " minutes"))
+		}
+	}
+
+	return thread
+}
+
+// parseCreatedBy parses a line such as "created by main.main in goroutine 1",
+// returning the creator function and the ID of its goroutine, which is only
+// printed from Go 1.21.
+func parseCreatedBy(line string) (string, int64, bool) {
+	rest, ok := strings.CutPrefix(line, "created by ")
+	if !ok {
+		return "", 0, false
+	}
+
+	creator, parent, _ := strings.Cut(rest, " in goroutine ")
+	id, _ := strconv.ParseInt(parent, 10, 64)
+	return creator, id, true
+}
+
+// frameArguments returns the arguments of a function line of a stack trace,
+// such as "main.f(0x1, {0x2, 0x3})".
+func frameArguments(line string) string {
+	if !strings.HasSuffix(line, ")") {
+		return ""
+	}
+	start := strings.LastIndex(line, "(")
+	if start < 0 {
+		return ""
+	}
+	return line[start+1 : len(line)-1]
+}
+
+// setGoroutineCounts sets the number of goroutines in stackTrace, in total and
+// by state, as attributes such as "goroutines.state.chan_receive".
+func setGoroutineCounts(attributes map[string]interface{}, stackTrace []byte) {
+	total := 0
+	states := map[string]int{}
+	for _, line := range strings.Split(string(stackTrace), "\n") {
+		if !strings.HasPrefix(line, "goroutine ") || !strings.HasSuffix(line, ":") {
+			continue
+		}
+		thread := newThread(line)
+		if thread.State == "" {
+			continue
+		}
+		total++
+		states[stateAttribute(thread.State)]++
+	}
+
+	if total == 0 {
+		return
+	}
+	attributes["goroutines.count"] = total
+	for state, count := range states {
+		attributes["goroutines.state."+state] = count
+	}
+}
+
+// stateAttribute turns a goroutine state such as "chan receive" or
+// "sync.Mutex.Lock" into a lowercase attribute key suffix.
+func stateAttribute(state string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '_'
+	}, state)
+}
+
 func trimCreatedBy(line string) string {
 	if strings.HasPrefix(line, "created by") {
 		_, line, _ = strings.Cut(line, " by ")
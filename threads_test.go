@@ -56,8 +56,10 @@ func TestParseThreadsFromStack(t *testing.T) {
 			},
 			wantThreads: map[string]Thread{
 				"0": {
-					Name:  "goroutine 1 [running]",
-					Fault: true,
+					Name:        "goroutine 1 [running]",
+					Fault:       true,
+					GoroutineID: 1,
+					State:       "running",
 					Stacks: []StackFrame{
 						{
 							FuncName:     "GetStack",
@@ -74,7 +76,11 @@ func TestParseThreadsFromStack(t *testing.T) {
 					},
 				},
 				"1": {
-					Name: "goroutine 6 [runnable]",
+					Name:              "goroutine 6 [runnable]",
+					GoroutineID:       6,
+					State:             "runnable",
+					CreatedBy:         "main.main",
+					ParentGoroutineID: 1,
 					Stacks: []StackFrame{
 						{
 							FuncName:     "testFunc",
@@ -91,7 +97,11 @@ func TestParseThreadsFromStack(t *testing.T) {
 					},
 				},
 				"2": {
-					Name: "goroutine 7 [runnable]",
+					Name:              "goroutine 7 [runnable]",
+					GoroutineID:       7,
+					State:             "runnable",
+					CreatedBy:         "main.main",
+					ParentGoroutineID: 1,
 					Stacks: []StackFrame{
 						{
 							FuncName:     "testFunc",
@@ -108,24 +118,32 @@ func TestParseThreadsFromStack(t *testing.T) {
 					},
 				},
 				"3": {
-					Name: "goroutine 8 [running]",
+					Name:        "goroutine 8 [running]",
+					GoroutineID: 8,
+					State:       "running",
 					Stacks: []StackFrame{
 						{
 							FuncName:     "main",
 							Library:      "main.test",
 							SourceCodeID: "1",
 							Line:         "74",
+							Arguments:    "0x9",
 						},
 					},
 				},
 				"4": {
-					Name: "goroutine 9 [running]",
+					Name:              "goroutine 9 [running]",
+					GoroutineID:       9,
+					State:             "running",
+					CreatedBy:         "testing.(*T).Run",
+					ParentGoroutineID: 1,
 					Stacks: []StackFrame{
 						{
 							FuncName:     "Run",
 							Library:      "testing.(*T)",
 							SourceCodeID: "2",
 							Line:         "12",
+							Arguments:    "0x14000110680, {0x1012116ab, 0x9}, 0x1012ff428",
 						},
 						{
 							FuncName:     "panic",
@@ -188,3 +206,114 @@ func TestParseThreadsFromStack(t *testing.T) {
 		})
 	}
 }
+
+func TestThreadFromCallers(t *testing.T) {
+	assert.Equal(t, "github.com/backtrace-labs/backtrace-go", packagePath)
+	assert.True(t, isPackageFunction(packagePath+".(*Client).Report", "/src/client.go"))
+	assert.False(t, isPackageFunction(packagePath+".TestThreadFromCallers", "/src/threads_test.go"))
+	assert.False(t, isPackageFunction(packagePath+"-fork.Report", "/src/client.go"))
+
+	pcs := callers()
+	thread := threadFromCallers("goroutine 1 [running]", pcs, true, newSourceFiles(4))
+	if assert.NotEmpty(t, thread.Stacks) {
+		frame := thread.Stacks[0]
+		assert.Equal(t, "TestThreadFromCallers", frame.FuncName)
+		assert.Equal(t, packagePath, frame.Library)
+		assert.NotEmpty(t, frame.Address)
+		assert.False(t, frame.Inlined)
+		assert.Equal(t, "tRunner", thread.Stacks[1].FuncName)
+	}
+}
+
+func TestClientReportCapturesReportingGoroutine(t *testing.T) {
+	client, recorder := newTestClient(t, OptionsStruct{CaptureAllGoroutines: true})
+
+	client.Report("message", nil)
+	client.FinishSendingReports()
+
+	recorder.m.Lock()
+	defer recorder.m.Unlock()
+	if !assert.Len(t, recorder.reports, 1) {
+		return
+	}
+
+	threads := recorder.reports[0]["threads"].(map[string]interface{})
+	assert.Greater(t, len(threads), 1)
+	attributes := recorder.reports[0]["attributes"].(map[string]interface{})
+	assert.GreaterOrEqual(t, attributes["goroutines.count"], float64(len(threads)))
+	assert.NotZero(t, attributes["goroutines.state.running"])
+	reporter := threads["0"].(map[string]interface{})
+	assert.Equal(t, true, reporter["fault"])
+	assert.Regexp(t, `^goroutine \d+ \[running\]$`, reporter["name"])
+	frame := reporter["stack"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "TestClientReportCapturesReportingGoroutine", frame["funcName"])
+	assert.NotEmpty(t, frame["address"])
+
+	for name, thread := range threads {
+		if name != "0" {
+			assert.Equal(t, false, thread.(map[string]interface{})["fault"])
+		}
+	}
+}
+
+func TestNewThread(t *testing.T) {
+	tests := []struct {
+		header string
+		want   Thread
+	}{
+		{
+			header: "goroutine 7 [chan receive, 5 minutes, locked to thread]:",
+			want: Thread{
+				Name:           "goroutine 7 [chan receive, 5 minutes, locked to thread]",
+				GoroutineID:    7,
+				State:          "chan receive",
+				WaitMinutes:    5,
+				LockedToThread: true,
+			},
+		},
+		{
+			header: "goroutine 18 gp=0xc000102380 m=nil [sync.Mutex.Lock]:",
+			want: Thread{
+				Name:        "goroutine 18 gp=0xc000102380 m=nil [sync.Mutex.Lock]",
+				GoroutineID: 18,
+				State:       "sync.Mutex.Lock",
+			},
+		},
+		{
+			header: "error origin",
+			want:   Thread{Name: "error origin"},
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, newThread(tt.header), tt.header)
+	}
+
+	creator, parent, ok := parseCreatedBy("created by net/http.(*Server).Serve in goroutine 1")
+	assert.True(t, ok)
+	assert.Equal(t, "net/http.(*Server).Serve", creator)
+	assert.Equal(t, int64(1), parent)
+
+	assert.Equal(t, "0x1, {0x2, 0x3}", frameArguments("main.(*T).f(0x1, {0x2, 0x3})"))
+	assert.Equal(t, "", frameArguments("created by main.main"))
+}
+
+func TestSetGoroutineCounts(t *testing.T) {
+	attributes := map[string]interface{}{}
+	setGoroutineCounts(attributes, []byte(stackTrace+`
+
+goroutine 10 [chan receive, 3 minutes]:
+main.wait()
+	/tmp/main.go:10 +0x1
+
+goroutine 11 [chan receive]:
+main.wait()
+	/tmp/main.go:10 +0x1
+`))
+
+	assert.Equal(t, map[string]interface{}{
+		"goroutines.count":              7,
+		"goroutines.state.running":      3,
+		"goroutines.state.runnable":     2,
+		"goroutines.state.chan_receive": 2,
+	}, attributes)
+}
@@ -0,0 +1,77 @@
+package bt
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultConnectTimeout  = 10 * time.Second
+	defaultResponseTimeout = 30 * time.Second
+)
+
+// newHTTPClient returns the HTTP client uploading reports, as configured by
+// options.
+func newHTTPClient(options *OptionsStruct) *http.Client {
+	if options.HTTPClient != nil {
+		return options.HTTPClient
+	}
+	if options.Transport != nil {
+		return &http.Client{Transport: options.Transport}
+	}
+
+	connectTimeout, responseTimeout := uploadTimeouts(options)
+	proxy := options.Proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	// Same as http.DefaultTransport, but for the settings above.
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: responseTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if options.TLSConfig != nil {
+		transport.TLSClientConfig = options.TLSConfig.Clone()
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+// uploadTimeouts returns ConnectTimeout and ResponseTimeout, or their
+// defaults.
+func uploadTimeouts(options *OptionsStruct) (time.Duration, time.Duration) {
+	connectTimeout := options.ConnectTimeout
+	if connectTimeout <= 0 {
+		connectTimeout = defaultConnectTimeout
+	}
+	responseTimeout := options.ResponseTimeout
+	if responseTimeout <= 0 {
+		responseTimeout = defaultResponseTimeout
+	}
+	return connectTimeout, responseTimeout
+}
+
+// uploadTimeout returns the time allowed for an upload attempt, from
+// connecting to reading the whole response, or 0 if HTTPClient is set and
+// is in charge of timeouts. The transport timeouts alone would let an
+// endpoint that stops reading the body hang the upload forever.
+func uploadTimeout(options *OptionsStruct) time.Duration {
+	if options.HTTPClient != nil {
+		return 0
+	}
+	connectTimeout, responseTimeout := uploadTimeouts(options)
+	return connectTimeout + responseTimeout
+}
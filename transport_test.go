@@ -0,0 +1,148 @@
+package bt
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestClientCustomTransport(t *testing.T) {
+	recorder := &reportRecorder{}
+	server := httptest.NewServer(recorder)
+	defer server.Close()
+
+	var requests atomic.Int32
+	client := NewClient(OptionsStruct{
+		Endpoint: server.URL,
+		Token:    "fake token",
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			requests.Add(1)
+			return http.DefaultTransport.RoundTrip(req)
+		}),
+	})
+	client.Report("through the transport", nil)
+	client.FinishSendingReports()
+
+	assert.Equal(t, int32(1), requests.Load())
+	assert.Len(t, recorder.attributes(), 1)
+}
+
+func TestClientResponseTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient(OptionsStruct{
+		Endpoint:        server.URL,
+		Token:           "fake token",
+		ResponseTimeout: 50 * time.Millisecond,
+	})
+	client.Report("hung endpoint", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := client.Close(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, DrainResult{Failed: 1}, result)
+}
+
+func TestClientUploadTimeout(t *testing.T) {
+	// Accepts connections but never reads from them, so writing a large
+	// report blocks before the response timeout even starts.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer listener.Close()
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				for _, conn := range conns {
+					conn.Close()
+				}
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	for name, transport := range map[string]http.RoundTripper{
+		"default":   nil,
+		"transport": http.DefaultTransport.(*http.Transport).Clone(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := NewClient(OptionsStruct{
+				Endpoint:               "http://" + listener.Addr().String(),
+				Token:                  "fake token",
+				Transport:              transport,
+				ConnectTimeout:         100 * time.Millisecond,
+				ResponseTimeout:        200 * time.Millisecond,
+				MaxAttachmentSize:      32 << 20,
+				MaxTotalAttachmentSize: 32 << 20,
+			})
+			client.Report("stalled endpoint", nil, WithAttachment("large", bytes.NewReader(make([]byte, 20<<20))))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			result, err := client.Close(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, DrainResult{Failed: 1}, result)
+		})
+	}
+}
+
+func TestClientMutualTLS(t *testing.T) {
+	recorder := &reportRecorder{}
+	server := httptest.NewUnstartedServer(recorder)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	client := NewClient(OptionsStruct{
+		Endpoint: server.URL,
+		Token:    "fake token",
+		TLSConfig: &tls.Config{
+			RootCAs:      roots,
+			Certificates: server.TLS.Certificates,
+		},
+	})
+	client.Report("over mTLS", nil)
+	client.FinishSendingReports()
+	assert.Len(t, recorder.attributes(), 1)
+
+	// Without a client certificate, the gateway turns the report down.
+	client = NewClient(OptionsStruct{
+		Endpoint:  server.URL,
+		Token:     "fake token",
+		TLSConfig: &tls.Config{RootCAs: roots},
+	})
+	client.Report("rejected", nil)
+	result, err := client.Close(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, DrainResult{Failed: 1}, result)
+}